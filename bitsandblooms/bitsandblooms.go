@@ -0,0 +1,173 @@
+// Copyright 2020 github.com/pschou/go-bloom-worm
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Read, write, and probe filters stored by github.com/bits-and-blooms/bloom/v3
+// so existing filters can be used without rebuilding them.
+
+package bitsandblooms
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/pschou/go-bloom/internal/murmur3"
+)
+
+// Filter mirrors a bits-and-blooms BloomFilter of M bits and K hashes.  Bit
+// i is stored at Bits[i/64] & (1 << (i%64)).
+//
+// Length is the length in bits of the underlying bitset, which can be more
+// than M in a filter read from elsewhere; zero means M.
+type Filter struct {
+	M, K   uint64
+	Length uint64
+	Bits   []uint64
+}
+
+// MaxK is the largest number of hashes ReadFrom accepts.  An optimally sized
+// filter needs about -log2(p) hashes, so this covers any realistic rate.
+const MaxK = 1024
+
+// New creates a filter of m bits using k hashes.
+func New(m, k uint64) *Filter {
+	if m < 1 {
+		m = 1
+	}
+	if k < 1 {
+		k = 1
+	}
+	return &Filter{M: m, K: k, Bits: make([]uint64, (m+63)/64)}
+}
+
+// NewWithEstimates sizes a filter for n items at false positive rate p, as
+// bloom.NewWithEstimates does.
+func NewWithEstimates(n uint64, p float64) *Filter {
+	m := math.Ceil(-1 * float64(n) * math.Log(p) / math.Pow(math.Log(2), 2))
+	k := math.Ceil(math.Log(2) * m / float64(n))
+	return New(uint64(m), uint64(k))
+}
+
+// ReadFrom reads a filter written by BloomFilter.WriteTo: big-endian uint64
+// m and k, followed by the bitset's big-endian uint64 length in bits and its
+// big-endian uint64 words.
+func ReadFrom(r io.Reader) (*Filter, error) {
+	var hdr [24]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, fmt.Errorf("Reading bloom header: %w", err)
+	}
+	f := &Filter{
+		M:      binary.BigEndian.Uint64(hdr[0:]),
+		K:      binary.BigEndian.Uint64(hdr[8:]),
+		Length: binary.BigEndian.Uint64(hdr[16:]),
+	}
+	length := f.Length
+	words := (length + 63) / 64
+	if f.M == 0 {
+		return nil, fmt.Errorf("Bloom filter has no bits")
+	} else if f.K > MaxK {
+		return nil, fmt.Errorf("Bloom hash count (%d) is over %d", f.K, MaxK)
+	} else if length < f.M {
+		return nil, fmt.Errorf("Bitset length (%d) is shorter than m (%d)", length, f.M)
+	} else if words < length/64 {
+		return nil, fmt.Errorf("Bitset length (%d) is too large", length)
+	}
+
+	// Grow as the data arrives rather than trusting the length up front
+	var buf [8 * 512]byte
+	for remain := words; remain > 0; {
+		chunk := remain
+		if chunk > 512 {
+			chunk = 512
+		}
+		if _, err := io.ReadFull(r, buf[:chunk*8]); err != nil {
+			return nil, fmt.Errorf("Reading bitset: %w", err)
+		}
+		for i := uint64(0); i < chunk; i++ {
+			f.Bits = append(f.Bits, binary.BigEndian.Uint64(buf[i*8:]))
+		}
+		remain -= chunk
+	}
+	if uint64(len(f.Bits)) < (f.M+63)/64 {
+		return nil, fmt.Errorf("Bitset of %d words is too short for m (%d)", len(f.Bits), f.M)
+	}
+	return f, nil
+}
+
+// WriteTo writes the filter in the layout read by BloomFilter.ReadFrom.
+func (f *Filter) WriteTo(w io.Writer) (int64, error) {
+	length := f.Length
+	if length == 0 {
+		length = f.M
+	}
+	if length < f.M {
+		return 0, fmt.Errorf("Bitset length (%d) is shorter than m (%d)", length, f.M)
+	} else if words := (length + 63) / 64; words < length/64 || uint64(len(f.Bits)) < words {
+		return 0, fmt.Errorf("Bitset of %d words is too short for %d bits", len(f.Bits), length)
+	}
+	buf := make([]byte, 0, 24+8*len(f.Bits))
+	buf = binary.BigEndian.AppendUint64(buf, f.M)
+	buf = binary.BigEndian.AppendUint64(buf, f.K)
+	buf = binary.BigEndian.AppendUint64(buf, length)
+	for _, v := range f.Bits[:(length+63)/64] {
+		buf = binary.BigEndian.AppendUint64(buf, v)
+	}
+	n, err := w.Write(buf)
+	return int64(n), err
+}
+
+// baseHashes is the murmur3 x64_128 hash of the data followed by the hash
+// of the data with a single byte 1 appended.
+func baseHashes(d []byte) [4]uint64 {
+	h1, h2 := murmur3.Sum128(d, 0)
+	h3, h4 := murmur3.Sum128Tail(d, []byte{1}, 0)
+	return [4]uint64{h1, h2, h3, h4}
+}
+
+// location returns the ith bit index for the base hashes.
+func (f *Filter) location(h [4]uint64, i uint64) uint64 {
+	return (h[i%2] + i*h[2+(((i+(i%2))%4)/2)]) % f.M
+}
+
+// Add a byte slice to the filter
+func (f *Filter) Add(d []byte) {
+	h := baseHashes(d)
+	for i := uint64(0); i < f.K; i++ {
+		loc := f.location(h, i)
+		f.Bits[loc>>6] |= 1 << (loc & 63)
+	}
+}
+
+// Test if a byte slice may be in the filter
+func (f *Filter) Test(d []byte) bool {
+	h := baseHashes(d)
+	for i := uint64(0); i < f.K; i++ {
+		loc := f.location(h, i)
+		if f.Bits[loc>>6]&(1<<(loc&63)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Add a string to the filter
+func (f *Filter) AddString(s string) {
+	f.Add([]byte(s))
+}
+
+// Test if the string may be in the filter
+func (f *Filter) TestString(s string) bool {
+	return f.Test([]byte(s))
+}
@@ -0,0 +1,129 @@
+package bitsandblooms_test
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/pschou/go-bloom/bitsandblooms"
+)
+
+// The golden files were written by github.com/bits-and-blooms/bloom/v3
+// v3.7.1 after adding the first half of the keys in the matching .exists
+// file, which records the library's Test result for every key.
+func TestGolden(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		f    *bitsandblooms.Filter
+	}{
+		{"estimates", bitsandblooms.NewWithEstimates(500, 0.01)},
+		{"odd", bitsandblooms.New(333, 5)},
+	} {
+		golden, err := os.ReadFile("testdata/" + tc.name + ".golden")
+		if err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := bitsandblooms.ReadFrom(bytes.NewReader(golden))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+
+		exists, err := os.ReadFile("testdata/" + tc.name + ".exists")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var keys []string
+		var want []bool
+		scan := bufio.NewScanner(bytes.NewReader(exists))
+		for scan.Scan() {
+			i := strings.LastIndexByte(scan.Text(), ' ')
+			key, err := strconv.Unquote(scan.Text()[:i])
+			if err != nil {
+				t.Fatal(err)
+			}
+			keys = append(keys, key)
+			want = append(want, scan.Text()[i+1:] == "1")
+		}
+
+		for i, key := range keys {
+			if got := loaded.TestString(key); got != want[i] {
+				t.Errorf("%s: Test(%q) = %v, want %v", tc.name, key, got, want[i])
+			}
+		}
+
+		// Building the same filter here writes identical bytes
+		for _, key := range keys[:len(keys)/2] {
+			tc.f.AddString(key)
+		}
+		var buf bytes.Buffer
+		if _, err := tc.f.WriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), golden) {
+			t.Errorf("%s: written filter does not match the golden file", tc.name)
+		}
+	}
+}
+
+func TestReadFromErrors(t *testing.T) {
+	for _, tc := range []string{
+		"",
+		"\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01\x00\x00\x00\x00\x00\x00\x00\x00",
+		"\x00\x00\x00\x00\x00\x00\x00\x40\x00\x00\x00\x00\x00\x00\x00\x01\x00\x00\x00\x00\x00\x00\x00\x20",
+		"\x00\x00\x00\x00\x00\x00\x00\x40\x00\x00\x00\x00\x00\x00\x00\x01\x00\x00\x00\x00\x00\x00\x00\x40\x00",
+		// m and length of 2^64-1, whose word count wraps to zero
+		"\xff\xff\xff\xff\xff\xff\xff\xff\x00\x00\x00\x00\x00\x00\x00\x01\xff\xff\xff\xff\xff\xff\xff\xff",
+		// k of 2^64-1
+		"\x00\x00\x00\x00\x00\x00\x00\x40\xff\xff\xff\xff\xff\xff\xff\xff\x00\x00\x00\x00\x00\x00\x00\x40" + strings.Repeat("\x00", 8),
+	} {
+		if _, err := bitsandblooms.ReadFrom(strings.NewReader(tc)); err == nil {
+			t.Errorf("expected an error reading %q", tc)
+		}
+	}
+}
+
+func ExampleReadFrom() {
+	filter := bitsandblooms.NewWithEstimates(100, 0.01)
+	filter.AddString("hello")
+
+	var buf bytes.Buffer
+	filter.WriteTo(&buf)
+
+	loaded, _ := bitsandblooms.ReadFrom(&buf)
+	fmt.Println("m", loaded.M, "k", loaded.K)
+	fmt.Println("test", loaded.TestString("hello"))
+	// Output:
+	// m 959 k 7
+	// test true
+}
+
+func TestWriteToLength(t *testing.T) {
+	// m=64 in a bitset of 128 bits, as written by a filter whose bitset grew
+	dump := "\x00\x00\x00\x00\x00\x00\x00\x40\x00\x00\x00\x00\x00\x00\x00\x03\x00\x00\x00\x00\x00\x00\x00\x80" +
+		"\x00\x00\x00\x00\x00\x00\x00\x01\x80\x00\x00\x00\x00\x00\x00\x00"
+	f, err := bitsandblooms.ReadFrom(strings.NewReader(dump))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != dump {
+		t.Errorf("wrote %x, want %x", buf.Bytes(), dump)
+	}
+
+	short := bitsandblooms.New(256, 3)
+	short.Bits = short.Bits[:2]
+	if _, err := short.WriteTo(&buf); err == nil {
+		t.Error("expected an error writing a bitset shorter than m")
+	}
+	f.Length = 32
+	if _, err := f.WriteTo(&buf); err == nil {
+		t.Error("expected an error writing a length shorter than m")
+	}
+}
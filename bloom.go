@@ -30,30 +30,36 @@ type Filter struct {
 
 // Test if the string may be in the filter
 func (f *Filter) TestString(s string) bool {
-	hash := zxxh3.Hash(s2b(s))
-	return f.Data[int(hash>>3)%len(f.Data)]&(1<<(hash&0x7)) > 0
+	return f.test(zxxh3.Hash(s2b(s)))
 }
 
 // Test if a byte slice may be in the filter
 func (f *Filter) Test(d []byte) bool {
-	hash := zxxh3.Hash(d)
-	return f.Data[int(hash>>3)%len(f.Data)]&(1<<(hash&0x7)) > 0
+	return f.test(zxxh3.Hash(d))
 }
 
 // Add a string to the filter
 func (f *Filter) AddString(s string) (hash uint64) {
 	hash = zxxh3.Hash(s2b(s))
-	f.Data[int(hash>>3)%len(f.Data)] |= 1 << (hash & 0x7)
+	f.add(hash)
 	return
 }
 
 // Add a byte slice to the filter
 func (f *Filter) Add(d []byte) (hash uint64) {
 	hash = zxxh3.Hash(d)
-	f.Data[int(hash>>3)%len(f.Data)] |= 1 << (hash & 0x7)
+	f.add(hash)
 	return
 }
 
+func (f *Filter) test(hash uint64) bool {
+	return f.Data[int(hash>>3)%len(f.Data)]&(1<<(hash&0x7)) > 0
+}
+
+func (f *Filter) add(hash uint64) {
+	f.Data[int(hash>>3)%len(f.Data)] |= 1 << (hash & 0x7)
+}
+
 func s2b(value string) (b []byte) {
 	bh := (*reflect.SliceHeader)(unsafe.Pointer(&b))
 	sh := (*reflect.StringHeader)(unsafe.Pointer(&value))
@@ -7,7 +7,7 @@ import (
 	bloom "github.com/pschou/go-bloom"
 )
 
-func ExampleAddString() {
+func ExampleFilter_AddString() {
 	filter := bloom.Filter{make([]byte, 100)}
 	filter.AddString("hello")
 	hit := filter.TestString("hello")
@@ -16,7 +16,7 @@ func ExampleAddString() {
 	// test true
 }
 
-func ExampleAdd() {
+func ExampleFilter_Add() {
 	filter := bloom.Filter{make([]byte, 100)}
 	filter.Add([]byte("hello"))
 	hit := filter.TestString("hello")
@@ -25,7 +25,7 @@ func ExampleAdd() {
 	// test true
 }
 
-func ExampleFold() {
+func ExampleFilter_Fold() {
 	filter := bloom.Filter{make([]byte, 100)}
 	filter.Add([]byte("hello"))
 
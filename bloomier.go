@@ -0,0 +1,126 @@
+// Copyright 2020 github.com/pschou/go-bloom-worm
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bwdb
+
+import (
+	"fmt"
+	"math/bits"
+
+	zxxh3 "github.com/zeebo/xxh3"
+)
+
+// A Bloomier maps a fixed set of keys to 8 bit values in about 1.23 bytes
+// per key.  Every key picks one slot in each third of Data and its value is
+// the XOR of the three; keys that were not in the map get an arbitrary value.
+type Bloomier struct {
+	Seed uint64
+	Data []uint8
+}
+
+// NewBloomier builds a Bloomier for the keys and values of m.  The slots are
+// assigned by peeling the 3-hypergraph of key slots, as for xor filters, and
+// construction is retried with the next seed when peeling gets stuck.
+func NewBloomier(m map[string]uint8) (*Bloomier, error) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	seg := (len(keys)*123/100+32)/3 + 1
+	for seed := uint64(0); seed < 100; seed++ {
+		b := &Bloomier{Seed: seed, Data: make([]uint8, 3*seg)}
+		if b.build(keys, m) {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("Bloomier construction failed for %d keys", len(keys))
+}
+
+// Get the value stored for a byte slice
+func (b *Bloomier) Get(d []byte) uint8 {
+	h0, h1, h2 := b.slots(zxxh3.HashSeed(d, b.Seed))
+	return b.Data[h0] ^ b.Data[h1] ^ b.Data[h2]
+}
+
+// Get the value stored for a string
+func (b *Bloomier) GetString(s string) uint8 {
+	return b.Get(s2b(s))
+}
+
+// slots returns one slot in each third of Data for a key hash.
+func (b *Bloomier) slots(hash uint64) (h0, h1, h2 int) {
+	seg := uint64(len(b.Data) / 3)
+	r0, _ := bits.Mul64(hash, seg)
+	r1, _ := bits.Mul64(bits.RotateLeft64(hash, 21), seg)
+	r2, _ := bits.Mul64(bits.RotateLeft64(hash, 42), seg)
+	return int(r0), int(seg + r1), int(2*seg + r2)
+}
+
+func (b *Bloomier) build(keys []string, m map[string]uint8) bool {
+	// Every slot keeps the number of keys on it and the XOR of their indices,
+	// so a slot with one key left names that key.
+	count := make([]int32, len(b.Data))
+	xor := make([]int, len(b.Data))
+	hs := make([][3]int, len(keys))
+	for i, k := range keys {
+		h0, h1, h2 := b.slots(zxxh3.HashStringSeed(k, b.Seed))
+		hs[i] = [3]int{h0, h1, h2}
+		for _, h := range hs[i] {
+			count[h]++
+			xor[h] ^= i
+		}
+	}
+
+	var queue []int
+	for h, c := range count {
+		if c == 1 {
+			queue = append(queue, h)
+		}
+	}
+	type peeled struct{ key, slot int }
+	stack := make([]peeled, 0, len(keys))
+	for len(queue) > 0 {
+		h := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		if count[h] != 1 {
+			continue
+		}
+		i := xor[h]
+		stack = append(stack, peeled{i, h})
+		for _, s := range hs[i] {
+			count[s]--
+			xor[s] ^= i
+			if count[s] == 1 {
+				queue = append(queue, s)
+			}
+		}
+	}
+	if len(stack) != len(keys) {
+		return false
+	}
+
+	// Assign in reverse peeling order, when the other two slots of the key
+	// are no longer changed by later keys.
+	for j := len(stack) - 1; j >= 0; j-- {
+		p := stack[j]
+		v := m[keys[p.key]]
+		for _, s := range hs[p.key] {
+			if s != p.slot {
+				v ^= b.Data[s]
+			}
+		}
+		b.Data[p.slot] = v
+	}
+	return true
+}
@@ -0,0 +1,66 @@
+package bwdb_test
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	bloom "github.com/pschou/go-bloom"
+)
+
+func ExampleBloomier() {
+	shards := map[string]uint8{"alice": 3, "bob": 7, "carol": 250}
+	b, _ := bloom.NewBloomier(shards)
+	fmt.Println("alice", b.GetString("alice"))
+	fmt.Println("carol", b.Get([]byte("carol")))
+	// Output:
+	// alice 3
+	// carol 250
+}
+
+func TestBloomier(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 10, 1000, 100000} {
+		m := make(map[string]uint8, n)
+		for i := 0; i < n; i++ {
+			m["key"+strconv.Itoa(i)] = uint8(i * 7)
+		}
+		b, err := bloom.NewBloomier(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range m {
+			if got := b.GetString(k); got != v {
+				t.Fatalf("%d keys: %q is %d, want %d", n, k, got, v)
+			}
+		}
+		if n == 100000 {
+			if per := float64(len(b.Data)) / float64(n); per > 1.24 {
+				t.Errorf("uses %.3f bytes per key", per)
+			}
+			// Non-members get values spread over the whole range
+			var seen [256]bool
+			for i := 0; i < 10000; i++ {
+				seen[b.GetString("other"+strconv.Itoa(i))] = true
+			}
+			for v, ok := range seen {
+				if !ok {
+					t.Errorf("value %d never returned for non-members", v)
+					break
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkBloomierGet(b *testing.B) {
+	m := make(map[string]uint8, 1<<16)
+	for i := 0; i < 1<<16; i++ {
+		m[strconv.Itoa(i)] = uint8(i)
+	}
+	dat := []byte("helloworld")
+	bl, _ := bloom.NewBloomier(m)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		bl.Get(dat)
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2020 github.com/pschou/go-bloom-worm
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Helpers for measuring the false positive rate of filters in tests.
+
+package bloomtest
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+
+	bloom "github.com/pschou/go-bloom"
+)
+
+// A Tester is any filter that can be probed with a byte slice key.
+type Tester interface {
+	Test([]byte) bool
+}
+
+// A Predictor knows its expected false positive rate after n distinct keys
+// have been added.  Filter variants can implement it so MeasureFPR reports
+// a theoretical value for them.
+type Predictor interface {
+	FalsePositiveRate(n int) float64
+}
+
+// A Filler reports the fraction of its bits that are set.  For a filter
+// that sets one bit per key, like bloom.Filter, this is exactly the chance
+// that a key not in the filter tests positive.
+type Filler interface {
+	FillRatio() float64
+}
+
+// Z is the normal quantile MeasureFPR uses for the confidence interval,
+// 1.96 for 95%.
+const Z = 1.96
+
+// Result is the outcome of MeasureFPR.
+type Result struct {
+	Probes         int
+	FalsePositives int
+	FalseNegatives int // inserted keys that tested negative, always a bug
+
+	Observed     float64 // FalsePositives / Probes
+	Lower, Upper float64 // Wilson score interval around Observed
+	Theoretical  float64 // from the number of keys, NaN when unknown
+	Expected     float64 // from the bits actually set, NaN when unknown
+}
+
+// Consistent reports if no inserted key was lost and the expected rate falls
+// inside the confidence interval.  The theoretical rate is used when the
+// expected one is unknown; it also carries the variance of how many bits the
+// inserted keys happened to set, so large probe sets can reject it by chance.
+func (r Result) Consistent() bool {
+	if r.FalseNegatives > 0 {
+		return false
+	}
+	want := r.Expected
+	if math.IsNaN(want) {
+		want = r.Theoretical
+	}
+	return math.IsNaN(want) || (r.Lower <= want && want <= r.Upper)
+}
+
+func (r Result) String() string {
+	return fmt.Sprintf("fpr %.5f [%.5f, %.5f] over %d probes, expected %.5f, theoretical %.5f, %d false negatives",
+		r.Observed, r.Lower, r.Upper, r.Probes, r.Expected, r.Theoretical, r.FalseNegatives)
+}
+
+// MeasureFPR checks every inserted key tests positive and counts how many of
+// probes, which must be disjoint from inserted, test positive.
+func MeasureFPR(f Tester, inserted, probes [][]byte) Result {
+	return MeasureFPRZ(f, inserted, probes, Z)
+}
+
+// MeasureFPRZ is MeasureFPR with the confidence interval taken at normal
+// quantile z.
+func MeasureFPRZ(f Tester, inserted, probes [][]byte, z float64) Result {
+	r := Result{Probes: len(probes), Theoretical: math.NaN(), Expected: math.NaN()}
+	for _, k := range inserted {
+		if !f.Test(k) {
+			r.FalseNegatives++
+		}
+	}
+	for _, k := range probes {
+		if f.Test(k) {
+			r.FalsePositives++
+		}
+	}
+	if r.Probes > 0 {
+		r.Observed = float64(r.FalsePositives) / float64(r.Probes)
+	}
+	r.Lower, r.Upper = Wilson(r.FalsePositives, r.Probes, z)
+
+	switch v := f.(type) {
+	case *bloom.Filter:
+		r.Theoretical = bloom.FalsePositiveRate(len(inserted), len(v.Data))
+	case Predictor:
+		r.Theoretical = v.FalsePositiveRate(len(inserted))
+	}
+	if v, ok := f.(Filler); ok {
+		r.Expected = v.FillRatio()
+	}
+	return r
+}
+
+// Wilson returns the Wilson score interval for k successes in n trials at
+// normal quantile z.
+func Wilson(k, n int, z float64) (lower, upper float64) {
+	if n == 0 {
+		return 0, 1
+	}
+	nf := float64(n)
+	p := float64(k) / nf
+	z2 := z * z
+	center := (p + z2/(2*nf)) / (1 + z2/nf)
+	half := z / (1 + z2/nf) * math.Sqrt(p*(1-p)/nf+z2/(4*nf*nf))
+	return math.Max(0, center-half), math.Min(1, center+half)
+}
+
+// DisjointKeys generates inserted and probe key sets of keyLen bytes (at
+// least 8) with no key in common.  The same seed gives the same keys.
+func DisjointKeys(seed int64, inserted, probes, keyLen int) (ins, prb [][]byte) {
+	if keyLen < 8 {
+		keyLen = 8
+	}
+	rng := rand.New(rand.NewSource(seed))
+	seen := make(map[uint64]struct{}, inserted+probes)
+	gen := func(n int) [][]byte {
+		out := make([][]byte, n)
+		for i := range out {
+			id := rng.Uint64()
+			for {
+				if _, dup := seen[id]; !dup {
+					break
+				}
+				id = rng.Uint64()
+			}
+			seen[id] = struct{}{}
+			k := make([]byte, keyLen)
+			binary.BigEndian.PutUint64(k, id)
+			rng.Read(k[8:])
+			out[i] = k
+		}
+		return out
+	}
+	return gen(inserted), gen(probes)
+}
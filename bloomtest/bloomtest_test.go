@@ -0,0 +1,91 @@
+package bloomtest_test
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"testing"
+
+	bloom "github.com/pschou/go-bloom"
+	"github.com/pschou/go-bloom/bloomtest"
+)
+
+func ExampleMeasureFPR() {
+	ins, probes := bloomtest.DisjointKeys(1, 1000, 100000, 16)
+	filter := bloom.Filter{Data: make([]byte, bloom.SizeFor(1000, 0.05))}
+	for _, k := range ins {
+		filter.Add(k)
+	}
+	r := bloomtest.MeasureFPR(&filter, ins, probes)
+	fmt.Println("consistent", r.Consistent())
+	// Output:
+	// consistent true
+}
+
+func TestFilterAndFolded(t *testing.T) {
+	ins, probes := bloomtest.DisjointKeys(1, 5000, 200000, 12)
+	filter := bloom.Filter{Data: make([]byte, 1<<14)}
+	for _, k := range ins {
+		filter.Add(k)
+	}
+	r := bloomtest.MeasureFPR(&filter, ins, probes)
+	if !r.Consistent() {
+		t.Errorf("filter: %v", r)
+	}
+	if wide := bloomtest.MeasureFPRZ(&filter, ins, probes, 3.29); wide.Lower >= r.Lower || wide.Upper <= r.Upper {
+		t.Errorf("99.9%% interval %v is not wider than %v", wide, r)
+	}
+	if math.Abs(r.Observed-r.Theoretical) > 0.002 {
+		t.Errorf("filter strays from theory: %v", r)
+	}
+	for _, n := range []int{2, 4} {
+		folded := bloom.Filter{Data: append([]byte(nil), filter.Data...)}
+		folded.Fold(n)
+		if r := bloomtest.MeasureFPR(&folded, ins, probes); !r.Consistent() {
+			t.Errorf("folded by %d: %v", n, r)
+		}
+	}
+}
+
+type lossy struct{ f bloom.Filter }
+
+func (l *lossy) Test(d []byte) bool { return l.f.Test(d) }
+
+func (l *lossy) FalsePositiveRate(n int) float64 { return 0.5 }
+
+func TestInconsistent(t *testing.T) {
+	ins, probes := bloomtest.DisjointKeys(7, 100, 10000, 8)
+	f := &lossy{bloom.Filter{Data: make([]byte, 1<<12)}}
+	for _, k := range ins[:50] {
+		f.f.Add(k)
+	}
+	r := bloomtest.MeasureFPR(f, ins, probes)
+	if r.FalseNegatives < 45 || r.Theoretical != 0.5 || !math.IsNaN(r.Expected) || r.Consistent() {
+		t.Errorf("unexpected result %v", r)
+	}
+}
+
+func TestDisjointKeys(t *testing.T) {
+	a, b := bloomtest.DisjointKeys(3, 1000, 1000, 4)
+	seen := make(map[string]bool)
+	for _, k := range append(a, b...) {
+		if len(k) != 8 || seen[string(k)] {
+			t.Fatalf("bad or duplicate key %x", k)
+		}
+		seen[string(k)] = true
+	}
+	c, _ := bloomtest.DisjointKeys(3, 1000, 0, 4)
+	if !bytes.Equal(a[999], c[999]) {
+		t.Error("keys are not reproducible from the seed")
+	}
+}
+
+func TestWilson(t *testing.T) {
+	lo, hi := bloomtest.Wilson(50, 1000, 1.96)
+	if math.Abs(lo-0.0381) > 0.0005 || math.Abs(hi-0.0653) > 0.0005 {
+		t.Errorf("interval [%.4f, %.4f]", lo, hi)
+	}
+	if lo, hi := bloomtest.Wilson(0, 0, 1.96); lo != 0 || hi != 1 {
+		t.Errorf("empty interval [%v, %v]", lo, hi)
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright 2020 github.com/pschou/go-bloom-worm
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// bloom-resp answers the RedisBloom BF.* commands over the Redis RESP2
+// protocol, holding the filters in memory.
+
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+)
+
+func main() {
+	listen := flag.String("listen", ":6379", "Address to listen on")
+	maxSize := flag.Int("max-size", 1<<30, "Largest filter BF.RESERVE creates, in bytes")
+	flag.Parse()
+
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("listening on %s", l.Addr())
+	log.Fatal(newServer(*maxSize).Serve(l))
+}
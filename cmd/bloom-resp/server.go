@@ -0,0 +1,373 @@
+// Copyright 2020 github.com/pschou/go-bloom-worm
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	bloom "github.com/pschou/go-bloom"
+)
+
+// Defaults RedisBloom uses when BF.ADD creates a filter.
+const (
+	defaultErrorRate = 0.01
+	defaultCapacity  = 100
+)
+
+const (
+	maxArgs    = 1 << 20
+	maxBulkLen = 512 << 20
+)
+
+type filter struct {
+	mu        sync.Mutex
+	f         bloom.Filter
+	capacity  int
+	errorRate float64
+	items     int
+}
+
+// add reports whether the item was not already in the filter.
+func (f *filter) add(item []byte) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.f.Test(item) {
+		return false
+	}
+	f.f.Add(item)
+	f.items++
+	return true
+}
+
+func (f *filter) test(item []byte) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.f.Test(item)
+}
+
+type server struct {
+	maxSize int // largest filter BF.RESERVE creates, in bytes
+
+	mu      sync.Mutex
+	filters map[string]*filter
+}
+
+func newServer(maxSize int) *server {
+	return &server{maxSize: maxSize, filters: make(map[string]*filter)}
+}
+
+// newFilter creates a filter sized for capacity items at errorRate, failing
+// when that is over maxSize bytes.
+func newFilter(errorRate float64, capacity, maxSize int) (*filter, error) {
+	size := bloom.SizeFor(capacity, errorRate)
+	if size == math.MaxInt || size > maxSize {
+		return nil, fmt.Errorf("filter size is over the limit of %d bytes", maxSize)
+	}
+	return &filter{
+		f:         bloom.Filter{Data: make([]byte, size)},
+		capacity:  capacity,
+		errorRate: errorRate,
+	}, nil
+}
+
+// lookup returns the named filter, creating it with default settings when
+// create is set.
+func (s *server) lookup(key string, create bool) *filter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := s.filters[key]
+	if f == nil && create {
+		// The default filter is small enough to never hit a limit
+		f, _ = newFilter(defaultErrorRate, defaultCapacity, math.MaxInt)
+		s.filters[key] = f
+	}
+	return f
+}
+
+// Serve accepts connections until the listener is closed.
+func (s *server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *server) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			if err != io.EOF {
+				writeError(w, "ERR Protocol error: "+err.Error())
+				w.Flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		quit := s.dispatch(w, args)
+		// Flush once the client has nothing more pipelined
+		if r.Buffered() == 0 || quit {
+			if err := w.Flush(); err != nil {
+				log.Println("write:", err)
+				return
+			}
+		}
+		if quit {
+			return
+		}
+	}
+}
+
+func (s *server) dispatch(w *bufio.Writer, args [][]byte) (quit bool) {
+	cmd := strings.ToUpper(string(args[0]))
+	args = args[1:]
+	switch cmd {
+	case "PING":
+		if len(args) > 0 {
+			writeBulk(w, args[0])
+		} else {
+			w.WriteString("+PONG\r\n")
+		}
+	case "QUIT":
+		w.WriteString("+OK\r\n")
+		return true
+	case "BF.RESERVE":
+		s.reserve(w, args)
+	case "BF.ADD":
+		if len(args) != 2 {
+			writeArity(w, cmd)
+			return
+		}
+		writeBool(w, s.lookup(string(args[0]), true).add(args[1]))
+	case "BF.MADD":
+		if len(args) < 2 {
+			writeArity(w, cmd)
+			return
+		}
+		f := s.lookup(string(args[0]), true)
+		fmt.Fprintf(w, "*%d\r\n", len(args)-1)
+		for _, item := range args[1:] {
+			writeBool(w, f.add(item))
+		}
+	case "BF.EXISTS":
+		if len(args) != 2 {
+			writeArity(w, cmd)
+			return
+		}
+		f := s.lookup(string(args[0]), false)
+		writeBool(w, f != nil && f.test(args[1]))
+	case "BF.MEXISTS":
+		if len(args) < 2 {
+			writeArity(w, cmd)
+			return
+		}
+		f := s.lookup(string(args[0]), false)
+		fmt.Fprintf(w, "*%d\r\n", len(args)-1)
+		for _, item := range args[1:] {
+			writeBool(w, f != nil && f.test(item))
+		}
+	case "BF.INFO":
+		s.info(w, args)
+	default:
+		writeError(w, fmt.Sprintf("ERR unknown command '%s'", strings.ToLower(cmd)))
+	}
+	return false
+}
+
+// BF.RESERVE key error_rate capacity [EXPANSION expansion] [NONSCALING]
+//
+// Filters never scale, so the expansion options are accepted and ignored.
+func (s *server) reserve(w *bufio.Writer, args [][]byte) {
+	if len(args) < 3 {
+		writeArity(w, "BF.RESERVE")
+		return
+	}
+	errorRate, err := strconv.ParseFloat(string(args[1]), 64)
+	if err != nil || errorRate <= 0 || errorRate >= 1 {
+		writeError(w, "ERR (0 < error rate range < 1)")
+		return
+	}
+	capacity, err := strconv.Atoi(string(args[2]))
+	if err != nil || capacity < 1 {
+		writeError(w, "ERR (capacity should be larger than 0)")
+		return
+	}
+	for opts := args[3:]; len(opts) > 0; opts = opts[1:] {
+		switch strings.ToUpper(string(opts[0])) {
+		case "NONSCALING":
+		case "EXPANSION":
+			if len(opts) < 2 {
+				writeError(w, "ERR no expansion given")
+				return
+			}
+			opts = opts[1:]
+		default:
+			writeError(w, "ERR unknown argument received")
+			return
+		}
+	}
+
+	key := string(args[0])
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.filters[key]; ok {
+		writeError(w, "ERR item exists")
+		return
+	}
+	f, err := newFilter(errorRate, capacity, s.maxSize)
+	if err != nil {
+		writeError(w, "ERR "+err.Error())
+		return
+	}
+	s.filters[key] = f
+	w.WriteString("+OK\r\n")
+}
+
+func (s *server) info(w *bufio.Writer, args [][]byte) {
+	if len(args) != 1 {
+		writeArity(w, "BF.INFO")
+		return
+	}
+	f := s.lookup(string(args[0]), false)
+	if f == nil {
+		writeError(w, "ERR not found")
+		return
+	}
+	f.mu.Lock()
+	size, items := len(f.f.Data), f.items
+	f.mu.Unlock()
+	w.WriteString("*10\r\n")
+	writeBulk(w, []byte("Capacity"))
+	fmt.Fprintf(w, ":%d\r\n", f.capacity)
+	writeBulk(w, []byte("Size"))
+	fmt.Fprintf(w, ":%d\r\n", size)
+	writeBulk(w, []byte("Number of filters"))
+	w.WriteString(":1\r\n")
+	writeBulk(w, []byte("Number of items inserted"))
+	fmt.Fprintf(w, ":%d\r\n", items)
+	writeBulk(w, []byte("Expansion rate"))
+	w.WriteString("$-1\r\n")
+}
+
+// readCommand reads a RESP2 array of bulk strings, or an inline command.
+func readCommand(r *bufio.Reader) ([][]byte, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		var args [][]byte
+		for _, f := range strings.Fields(string(line)) {
+			args = append(args, []byte(f))
+		}
+		return args, nil
+	}
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n < 0 || n > maxArgs {
+		return nil, fmt.Errorf("invalid multibulk length")
+	}
+	// Neither the count nor the bulk lengths decide how much is allocated,
+	// only the data that actually arrives
+	var args [][]byte
+	for i := 0; i < n; i++ {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, unexpected(err)
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, fmt.Errorf("expected '$', got '%.1s'", line)
+		}
+		size, err := strconv.Atoi(string(line[1:]))
+		if err != nil || size < 0 || size > maxBulkLen {
+			return nil, fmt.Errorf("invalid bulk length")
+		}
+		var buf bytes.Buffer
+		if _, err := io.CopyN(&buf, r, int64(size)); err != nil {
+			return nil, unexpected(err)
+		}
+		var crlf [2]byte
+		if _, err := io.ReadFull(r, crlf[:]); err != nil {
+			return nil, unexpected(err)
+		}
+		if crlf != [2]byte{'\r', '\n'} {
+			return nil, fmt.Errorf("bulk string not terminated")
+		}
+		args = append(args, buf.Bytes())
+	}
+	return args, nil
+}
+
+func readLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		if err == bufio.ErrBufferFull {
+			return nil, fmt.Errorf("line too long")
+		}
+		if err == io.EOF && len(line) > 0 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return []byte(strings.TrimRight(string(line), "\r\n")), nil
+}
+
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func writeBool(w *bufio.Writer, b bool) {
+	if b {
+		w.WriteString(":1\r\n")
+	} else {
+		w.WriteString(":0\r\n")
+	}
+}
+
+func writeBulk(w *bufio.Writer, b []byte) {
+	fmt.Fprintf(w, "$%d\r\n", len(b))
+	w.Write(b)
+	w.WriteString("\r\n")
+}
+
+func writeError(w *bufio.Writer, msg string) {
+	w.WriteString("-" + msg + "\r\n")
+}
+
+func writeArity(w *bufio.Writer, cmd string) {
+	writeError(w, fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd)))
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dial(t *testing.T) *client {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go newServer(1 << 20).Serve(l)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &client{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+// do sends a command and returns the reply flattened to a string, with
+// arrays as space separated elements.
+func (c *client) do(args ...string) string {
+	c.t.Helper()
+	fmt.Fprintf(c.conn, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(c.conn, "$%d\r\n%s\r\n", len(a), a)
+	}
+	return c.reply()
+}
+
+func (c *client) reply() string {
+	c.t.Helper()
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	switch line[0] {
+	case '*':
+		var n int
+		fmt.Sscan(line[1:], &n)
+		var parts []string
+		for i := 0; i < n; i++ {
+			parts = append(parts, c.reply())
+		}
+		return strings.Join(parts, " ")
+	case '$':
+		var n int
+		fmt.Sscan(line[1:], &n)
+		if n < 0 {
+			return "(nil)"
+		}
+		buf := make([]byte, n+2)
+		if _, err := c.r.Read(buf); err != nil {
+			c.t.Fatal(err)
+		}
+		return string(buf[:n])
+	}
+	return line
+}
+
+func TestCommands(t *testing.T) {
+	c := dial(t)
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"PING"}, "+PONG"},
+		{[]string{"BF.RESERVE", "users", "0.001", "1000"}, "+OK"},
+		{[]string{"BF.RESERVE", "users", "0.001", "1000"}, "-ERR item exists"},
+		{[]string{"BF.RESERVE", "bad", "2", "1000"}, "-ERR (0 < error rate range < 1)"},
+		{[]string{"BF.RESERVE", "big", "0.01", "100", "EXPANSION", "4", "NONSCALING"}, "+OK"},
+		{[]string{"BF.RESERVE", "huge", "0.01", "1000000"}, "-ERR filter size is over the limit of 1048576 bytes"},
+		{[]string{"BF.RESERVE", "huge", "1e-9", "9223372036854775807"}, "-ERR filter size is over the limit of 1048576 bytes"},
+		{[]string{"BF.EXISTS", "huge", "x"}, ":0"},
+		{[]string{"BF.ADD", "users", "alice"}, ":1"},
+		{[]string{"BF.ADD", "users", "alice"}, ":0"},
+		{[]string{"BF.MADD", "users", "bob", "alice", "carol"}, ":1 :0 :1"},
+		{[]string{"BF.EXISTS", "users", "bob"}, ":1"},
+		{[]string{"BF.EXISTS", "users", "mallory"}, ":0"},
+		{[]string{"BF.EXISTS", "nobody", "bob"}, ":0"},
+		{[]string{"BF.MEXISTS", "users", "alice", "mallory", "carol"}, ":1 :0 :1"},
+		{[]string{"BF.INFO", "users"}, "Capacity :1000 Size :124938 Number of filters :1 Number of items inserted :3 Expansion rate (nil)"},
+		{[]string{"BF.INFO", "nobody"}, "-ERR not found"},
+		{[]string{"BF.ADD", "auto", "x"}, ":1"},
+		{[]string{"BF.INFO", "auto"}, "Capacity :100 Size :1244 Number of filters :1 Number of items inserted :1 Expansion rate (nil)"},
+		{[]string{"BF.ADD", "users"}, "-ERR wrong number of arguments for 'bf.add' command"},
+		{[]string{"FLUSHALL"}, "-ERR unknown command 'flushall'"},
+	} {
+		if got := c.do(tc.args...); got != tc.want {
+			t.Errorf("%q: got %q, want %q", tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestPipelineAndInline(t *testing.T) {
+	c := dial(t)
+	// Several commands in one write, the last one inline
+	fmt.Fprint(c.conn, "*3\r\n$6\r\nBF.ADD\r\n$1\r\nk\r\n$1\r\na\r\n"+
+		"*3\r\n$9\r\nBF.EXISTS\r\n$1\r\nk\r\n$1\r\na\r\n"+
+		"BF.EXISTS k b\r\n")
+	for _, want := range []string{":1", ":1", ":0"} {
+		if got := c.reply(); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+	if got := c.do("QUIT"); got != "+OK" {
+		t.Errorf("QUIT returned %q", got)
+	}
+}
+
+func TestProtocolError(t *testing.T) {
+	c := dial(t)
+	fmt.Fprint(c.conn, "*1\r\n+PING\r\n")
+	if got := c.reply(); !strings.HasPrefix(got, "-ERR Protocol error") {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestHugeLengths(t *testing.T) {
+	// Headers promising 512 MiB and a million arguments, with no data
+	for _, req := range []string{"*1\r\n$536870911\r\nabc", "*1048576\r\n$1\r\nx\r\n"} {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		if _, err := readCommand(bufio.NewReader(strings.NewReader(req))); err == nil {
+			t.Errorf("%q: expected an error", req)
+		}
+		runtime.ReadMemStats(&after)
+		if n := after.TotalAlloc - before.TotalAlloc; n > 1<<20 {
+			t.Errorf("%q: allocated %d bytes", req, n)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2020 github.com/pschou/go-bloom-worm
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// bloomd serves named bloom filters over HTTP, saving them to disk
+// periodically.  Each filter is split into -shards shards for concurrent
+// writers, and every shard is as large as the whole filter, so a filter of
+// size bytes uses size times -shards bytes of memory.
+
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	bloom "github.com/pschou/go-bloom"
+)
+
+func main() {
+	listen := flag.String("listen", ":8080", "Address to listen on")
+	dir := flag.String("dir", ".", "Directory for saved filters")
+	interval := flag.Duration("interval", time.Minute, "How often to save changed filters")
+	shards := flag.Int("shards", 16, "Shards per filter, a power of two; each is a full copy of the filter size, so memory is size times shards")
+	maxSize := flag.Int("max-size", 1<<30, "Largest filter in bytes, counting every shard, so a size of at most max-size/shards")
+	flag.Parse()
+
+	if _, err := bloom.NewShardedFilter(*shards, 1); err != nil {
+		log.Fatal(err)
+	}
+	s := newServer(*dir, *shards, *maxSize)
+	if err := s.load(); err != nil {
+		log.Fatal(err)
+	}
+
+	go func() {
+		for range time.Tick(*interval) {
+			if err := s.persist(); err != nil {
+				log.Println("saving filters:", err)
+			}
+		}
+	}()
+
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		if err := s.persist(); err != nil {
+			log.Println("saving filters:", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}()
+
+	log.Printf("listening on %s", *listen)
+	log.Fatal(http.ListenAndServe(*listen, s))
+}
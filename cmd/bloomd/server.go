@@ -0,0 +1,383 @@
+// Copyright 2020 github.com/pschou/go-bloom-worm
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	bloom "github.com/pschou/go-bloom"
+)
+
+const maxKeyBody = 1 << 20
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9_.-]*$`)
+
+type entry struct {
+	f     *bloom.ShardedFilter
+	adds  atomic.Uint64
+	dirty atomic.Bool
+}
+
+type server struct {
+	dir     string
+	shards  int
+	maxSize int // bytes across all shards of one filter
+
+	mu      sync.RWMutex
+	filters map[string]*entry
+}
+
+func newServer(dir string, shards, maxSize int) *server {
+	return &server{dir: dir, shards: shards, maxSize: maxSize, filters: make(map[string]*entry)}
+}
+
+// maxShardSize is the largest shard size newEntry accepts.
+func (s *server) maxShardSize() int {
+	return s.maxSize / s.shards
+}
+
+func (s *server) newEntry(size int) (*entry, error) {
+	if size > s.maxShardSize() {
+		return nil, fmt.Errorf("Filter size (%d) over %d shards is over the limit (%d)", size, s.shards, s.maxSize)
+	}
+	f, err := bloom.NewShardedFilter(s.shards, size)
+	if err != nil {
+		return nil, err
+	}
+	return &entry{f: f}, nil
+}
+
+func (s *server) get(name string) *entry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.filters[name]
+}
+
+// ServeHTTP routes the requests below.  The size of a filter is the size of
+// each of its shards and of the merged snapshot, so a filter takes size times
+// the shard count in memory; a capacity and fpr give the size one plain
+// filter needs.
+//
+//	GET  /filters                 list filter names
+//	PUT  /filters/{name}          create from {"size": bytes} or {"capacity": n, "fpr": p}
+//	POST /filters/{name}/add      add {"key": k} or {"keys": [...]}, or a raw binary key
+//	POST /filters/{name}/test     test {"key": k} or {"keys": [...]}, or a raw binary key
+//	GET  /filters/{name}/stats    filter statistics
+//	GET  /filters/{name}/snapshot download the merged filter, compressed
+//	PUT  /filters/{name}/snapshot upload a compressed filter, creating or replacing it
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path, "/")
+	if path == "filters" {
+		if r.Method != http.MethodGet {
+			httpError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		s.list(w)
+		return
+	}
+	parts := strings.Split(path, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] != "filters" || !validName.MatchString(parts[1]) {
+		httpError(w, http.StatusNotFound, "not found")
+		return
+	}
+	name, action := parts[1], ""
+	if len(parts) == 3 {
+		action = parts[2]
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodPut:
+		s.create(w, r, name)
+	case action == "add" && r.Method == http.MethodPost:
+		s.addOrTest(w, r, name, true)
+	case action == "test" && r.Method == http.MethodPost:
+		s.addOrTest(w, r, name, false)
+	case action == "stats" && r.Method == http.MethodGet:
+		s.stats(w, name)
+	case action == "snapshot" && r.Method == http.MethodGet:
+		s.download(w, name)
+	case action == "snapshot" && r.Method == http.MethodPut:
+		s.upload(w, r, name)
+	case action == "" || action == "add" || action == "test" || action == "stats" || action == "snapshot":
+		httpError(w, http.StatusMethodNotAllowed, "method not allowed")
+	default:
+		httpError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (s *server) list(w http.ResponseWriter) {
+	s.mu.RLock()
+	names := make([]string, 0, len(s.filters))
+	for name := range s.filters {
+		names = append(names, name)
+	}
+	s.mu.RUnlock()
+	sort.Strings(names)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"filters": names})
+}
+
+type createRequest struct {
+	Size     int     `json:"size"`
+	Capacity int     `json:"capacity"`
+	FPR      float64 `json:"fpr"`
+}
+
+func (s *server) create(w http.ResponseWriter, r *http.Request, name string) {
+	var req createRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxKeyBody)).Decode(&req); err != nil {
+		httpError(w, http.StatusBadRequest, "invalid create request: "+err.Error())
+		return
+	}
+	size := req.Size
+	if size == 0 {
+		if req.Capacity < 1 || req.FPR <= 0 || req.FPR >= 1 {
+			httpError(w, http.StatusBadRequest, "need a size, or a capacity and an fpr between 0 and 1")
+			return
+		}
+		size = bloom.SizeFor(req.Capacity, req.FPR)
+	}
+	e, err := s.newEntry(size)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	if _, ok := s.filters[name]; ok {
+		s.mu.Unlock()
+		httpError(w, http.StatusConflict, "filter already exists")
+		return
+	}
+	e.dirty.Store(true)
+	s.filters[name] = e
+	s.mu.Unlock()
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"name": name, "size": size})
+}
+
+type keysRequest struct {
+	Key  *string  `json:"key"`
+	Keys []string `json:"keys"`
+}
+
+func (s *server) addOrTest(w http.ResponseWriter, r *http.Request, name string, add bool) {
+	e := s.get(name)
+	if e == nil {
+		httpError(w, http.StatusNotFound, "no such filter")
+		return
+	}
+
+	var keys [][]byte
+	single := true
+	if r.Header.Get("Content-Type") == "application/octet-stream" {
+		b, err := io.ReadAll(io.LimitReader(r.Body, maxKeyBody))
+		if err != nil {
+			httpError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		keys = append(keys, b)
+	} else {
+		var req keysRequest
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxKeyBody)).Decode(&req); err != nil {
+			httpError(w, http.StatusBadRequest, "invalid key request: "+err.Error())
+			return
+		}
+		switch {
+		case req.Key != nil && req.Keys == nil:
+			keys = append(keys, []byte(*req.Key))
+		case req.Key == nil && req.Keys != nil:
+			single = false
+			for _, k := range req.Keys {
+				keys = append(keys, []byte(k))
+			}
+		default:
+			httpError(w, http.StatusBadRequest, `need one of "key" or "keys"`)
+			return
+		}
+	}
+
+	if add {
+		for _, k := range keys {
+			e.f.Add(k)
+		}
+		e.adds.Add(uint64(len(keys)))
+		e.dirty.Store(true)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	results := make([]bool, len(keys))
+	for i, k := range keys {
+		results[i] = e.f.Test(k)
+	}
+	if single {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"result": results[0]})
+	} else {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"results": results})
+	}
+}
+
+func (s *server) stats(w http.ResponseWriter, name string) {
+	e := s.get(name)
+	if e == nil {
+		httpError(w, http.StatusNotFound, "no such filter")
+		return
+	}
+	fill := e.f.Merge().FillRatio()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"name":       name,
+		"shards":     s.shards,
+		"size":       e.f.Size(),
+		"adds":       e.adds.Load(),
+		"fill_ratio": fill,
+	})
+}
+
+func (s *server) download(w http.ResponseWriter, name string) {
+	e := s.get(name)
+	if e == nil {
+		httpError(w, http.StatusNotFound, "no such filter")
+		return
+	}
+	buf := e.f.Merge().MarshalCompressed()
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", fmt.Sprint(len(buf)))
+	w.Write(buf)
+}
+
+func (s *server) upload(w http.ResponseWriter, r *http.Request, name string) {
+	// No encoding of a filter within the limit is longer than the raw one
+	limit := int64(s.maxShardSize()) + 1 + binary.MaxVarintLen64
+	b, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err.Error())
+		return
+	} else if int64(len(b)) > limit {
+		httpError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("snapshot is larger than %d bytes", limit))
+		return
+	}
+	var f bloom.Filter
+	if err := f.UnmarshalCompressedLimit(b, s.maxShardSize()); err != nil {
+		httpError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	e, err := s.newEntry(len(f.Data))
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	e.f.Load(&f)
+	e.dirty.Store(true)
+
+	s.mu.Lock()
+	s.filters[name] = e
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// persist writes every filter changed since the last call to the data
+// directory, replacing the previous file atomically.  A filter that fails to
+// write stays dirty for the next call, and the others are still written.
+func (s *server) persist() error {
+	s.mu.RLock()
+	dirty := make(map[string]*entry)
+	for name, e := range s.filters {
+		if e.dirty.Swap(false) {
+			dirty[name] = e
+		}
+	}
+	s.mu.RUnlock()
+
+	var errs []error
+	for name, e := range dirty {
+		if err := writeFileAtomic(filepath.Join(s.dir, name+".bloom"), e.f.Merge().MarshalCompressed()); err != nil {
+			e.dirty.Store(true)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// load reads every filter saved by persist.
+func (s *server) load() error {
+	files, err := filepath.Glob(filepath.Join(s.dir, "*.bloom"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".bloom")
+		if !validName.MatchString(name) {
+			continue
+		}
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		var f bloom.Filter
+		if err := f.UnmarshalCompressedLimit(b, s.maxShardSize()); err != nil {
+			return fmt.Errorf("Loading %s: %w", file, err)
+		}
+		e, err := s.newEntry(len(f.Data))
+		if err != nil {
+			return fmt.Errorf("Loading %s: %w", file, err)
+		}
+		e.f.Load(&f)
+		s.filters[name] = e
+		log.Printf("loaded filter %q (%d bytes)", name, len(f.Data))
+	}
+	return nil
+}
+
+func writeFileAtomic(name string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".tmp-"+filepath.Base(name))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func httpError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	bloom "github.com/pschou/go-bloom"
+)
+
+func do(t *testing.T, ts *httptest.Server, method, path, ctype, body string) (int, map[string]interface{}) {
+	t.Helper()
+	req, err := http.NewRequest(method, ts.URL+path, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ctype != "" {
+		req.Header.Set("Content-Type", ctype)
+	}
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var out map[string]interface{}
+	b, _ := io.ReadAll(resp.Body)
+	if len(b) > 0 && resp.Header.Get("Content-Type") == "application/json" {
+		if err := json.Unmarshal(b, &out); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode, out
+}
+
+func TestServer(t *testing.T) {
+	dir := t.TempDir()
+	s := newServer(dir, 4, 1<<20)
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	if code, _ := do(t, ts, "PUT", "/filters/users", "", `{"capacity": 1000, "fpr": 0.01}`); code != http.StatusCreated {
+		t.Fatalf("create returned %d", code)
+	}
+	if code, _ := do(t, ts, "PUT", "/filters/users", "", `{"size": 100}`); code != http.StatusConflict {
+		t.Errorf("duplicate create returned %d", code)
+	}
+	if code, _ := do(t, ts, "PUT", "/filters/bad", "", `{}`); code != http.StatusBadRequest {
+		t.Errorf("create without a size returned %d", code)
+	}
+
+	if code, _ := do(t, ts, "POST", "/filters/users/add", "", `{"keys": ["alice", "bob"]}`); code != http.StatusNoContent {
+		t.Fatalf("batch add returned %d", code)
+	}
+	if code, _ := do(t, ts, "POST", "/filters/users/add", "application/octet-stream", "\x00carol"); code != http.StatusNoContent {
+		t.Fatalf("binary add returned %d", code)
+	}
+
+	_, out := do(t, ts, "POST", "/filters/users/test", "", `{"keys": ["alice", "bob", "mallory"]}`)
+	if got, _ := json.Marshal(out["results"]); string(got) != "[true,true,false]" {
+		t.Errorf("batch test returned %s", got)
+	}
+	_, out = do(t, ts, "POST", "/filters/users/test", "application/octet-stream", "\x00carol")
+	if out["result"] != true {
+		t.Errorf("binary test returned %v", out)
+	}
+	_, out = do(t, ts, "POST", "/filters/users/test", "", `{"key": "dave"}`)
+	if out["result"] != false {
+		t.Errorf("single test returned %v", out)
+	}
+
+	_, out = do(t, ts, "GET", "/filters/users/stats", "", "")
+	if out["adds"] != 3.0 || out["size"] != 12438.0 {
+		t.Errorf("unexpected stats %v", out)
+	}
+
+	// Download the snapshot and upload it as a new filter
+	resp, err := ts.Client().Get(ts.URL + "/filters/users/snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if code, _ := do(t, ts, "PUT", "/filters/copy/snapshot", "", string(snap)); code != http.StatusNoContent {
+		t.Fatalf("upload returned %d", code)
+	}
+	_, out = do(t, ts, "POST", "/filters/copy/test", "", `{"key": "bob"}`)
+	if out["result"] != true {
+		t.Errorf("uploaded filter lost a key: %v", out)
+	}
+
+	_, out = do(t, ts, "GET", "/filters", "", "")
+	if got, _ := json.Marshal(out["filters"]); string(got) != `["copy","users"]` {
+		t.Errorf("list returned %s", got)
+	}
+	if code, _ := do(t, ts, "POST", "/filters/missing/test", "", `{"key": "x"}`); code != http.StatusNotFound {
+		t.Errorf("missing filter returned %d", code)
+	}
+	if code, _ := do(t, ts, "GET", "/filters/users/add", "", ""); code != http.StatusMethodNotAllowed {
+		t.Errorf("wrong method returned %d", code)
+	}
+
+	// Persist and load into a fresh server
+	if err := s.persist(); err != nil {
+		t.Fatal(err)
+	}
+	restored := newServer(dir, 8, 1<<20)
+	if err := restored.load(); err != nil {
+		t.Fatal(err)
+	}
+	if e := restored.get("users"); e == nil || !e.f.TestString("alice") || e.f.TestString("mallory") {
+		t.Error("persisted filter did not load correctly")
+	}
+}
+
+func TestLimits(t *testing.T) {
+	s := newServer(t.TempDir(), 4, 4000)
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	if code, _ := do(t, ts, "PUT", "/filters/ok", "", `{"size": 1000}`); code != http.StatusCreated {
+		t.Errorf("create at the limit returned %d", code)
+	}
+	if code, _ := do(t, ts, "PUT", "/filters/big", "", `{"size": 1001}`); code != http.StatusBadRequest {
+		t.Errorf("create over the limit returned %d", code)
+	}
+	if code, _ := do(t, ts, "PUT", "/filters/huge", "", `{"capacity": 9223372036854775807, "fpr": 1e-9}`); code != http.StatusBadRequest {
+		t.Errorf("create with an overflowing capacity returned %d", code)
+	}
+
+	big := bloom.Filter{Data: make([]byte, 2000)}
+	if code, _ := do(t, ts, "PUT", "/filters/big/snapshot", "", string(big.MarshalCompressed())); code != http.StatusBadRequest {
+		t.Errorf("upload over the limit returned %d", code)
+	}
+	if code, _ := do(t, ts, "PUT", "/filters/big/snapshot", "", strings.Repeat("x", 1000+1+binary.MaxVarintLen64+1)); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("upload of an oversized body returned %d", code)
+	}
+	if s.get("big") != nil {
+		t.Error("filter over the limit was created")
+	}
+}
+
+func TestPersistError(t *testing.T) {
+	dir := t.TempDir()
+	s := newServer(dir, 1, 1<<20)
+	for _, name := range []string{"a", "b", "c"} {
+		e, err := s.newEntry(100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.dirty.Store(true)
+		s.filters[name] = e
+	}
+	// A non-empty directory in the way makes renaming over b fail
+	if err := os.MkdirAll(filepath.Join(dir, "b.bloom", "x"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.persist(); err == nil {
+		t.Fatal("expected an error saving b")
+	}
+	for name, dirty := range map[string]bool{"a": false, "b": true, "c": false} {
+		if got := s.get(name).dirty.Load(); got != dirty {
+			t.Errorf("%s: dirty %v, want %v", name, got, dirty)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "c.bloom")); err != nil {
+		t.Error("c was not saved:", err)
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright 2020 github.com/pschou/go-bloom-worm
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bwdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+)
+
+// Encodings used by MarshalCompressed, stored in the first byte.
+const (
+	encRaw       = 0 // Data bytes as-is
+	encRLE       = 1 // (uvarint run length, byte value) pairs
+	encSparse    = 2 // uvarint count, then delta varint positions of set bits
+	encSparseInv = 3 // uvarint count, then delta varint positions of clear bits
+)
+
+// MarshalCompressed encodes the filter into a compact form.  The encoding is
+// chosen from the fill ratio of the filter: near-empty or near-full filters
+// are written as the positions of the minority bits, filters with long runs
+// of equal bytes are run-length encoded, and anything else is written raw.
+//
+// The layout is one encoding byte, the uvarint length of Data, and the
+// encoded payload.
+func (f *Filter) MarshalCompressed() []byte {
+	nbits := uint64(len(f.Data)) * 8
+	var ones uint64
+	runs := 0
+	for i, v := range f.Data {
+		ones += uint64(bits.OnesCount8(v))
+		if i == 0 || v != f.Data[i-1] {
+			runs++
+		}
+	}
+
+	minority, inv := ones, false
+	if zeros := nbits - ones; zeros < ones {
+		minority, inv = zeros, true
+	}
+
+	rawSize := uint64(len(f.Data))
+	rleSize := uint64(runs) * uint64(1+uvarintLen(rawSize/uint64(runs+1)+1))
+	sparseSize := uint64(uvarintLen(minority)) + minority*uint64(uvarintLen(nbits/(minority+1)))
+
+	out := make([]byte, 1, 1+binary.MaxVarintLen64)
+	out = binary.AppendUvarint(out, uint64(len(f.Data)))
+	switch {
+	case sparseSize < rawSize && sparseSize <= rleSize:
+		out[0] = encSparse
+		if inv {
+			out[0] = encSparseInv
+		}
+		out = appendSparse(out, f.Data, minority, inv)
+	case rleSize < rawSize:
+		out[0] = encRLE
+		out = appendRLE(out, f.Data)
+	default:
+		out[0] = encRaw
+		out = append(out, f.Data...)
+	}
+	return out
+}
+
+// MaxCompressedSize is the largest filter, in bytes, UnmarshalCompressed
+// accepts.  The length in the header is trusted for the allocation, so a few
+// hostile bytes could otherwise ask for any amount of memory.
+const MaxCompressedSize = 1 << 30
+
+// UnmarshalCompressed replaces the filter contents with data produced by
+// MarshalCompressed, for filters up to MaxCompressedSize bytes.
+func (f *Filter) UnmarshalCompressed(b []byte) error {
+	return f.UnmarshalCompressedLimit(b, MaxCompressedSize)
+}
+
+// UnmarshalCompressedLimit is UnmarshalCompressed for filters up to max
+// bytes.  The length is checked before anything is allocated.
+func (f *Filter) UnmarshalCompressedLimit(b []byte, max int) error {
+	if len(b) < 1 {
+		return fmt.Errorf("Compressed filter is empty")
+	}
+	enc := b[0]
+	size, n := binary.Uvarint(b[1:])
+	if n <= 0 {
+		return fmt.Errorf("Compressed filter has an invalid length")
+	}
+	if max < 0 || size > uint64(max) || size > uint64(int(^uint(0)>>1))/8 {
+		return fmt.Errorf("Compressed filter length (%d) is larger than the limit (%d)", size, max)
+	}
+	b = b[1+n:]
+
+	var dat []byte
+	var err error
+	switch enc {
+	case encRaw:
+		if uint64(len(b)) != size {
+			return fmt.Errorf("Raw filter length (%d) does not match header (%d)", len(b), size)
+		}
+		dat = append([]byte(nil), b...)
+	case encRLE:
+		dat, err = decodeRLE(b, size)
+	case encSparse, encSparseInv:
+		dat, err = decodeSparse(b, size, enc == encSparseInv)
+	default:
+		return fmt.Errorf("Unknown filter encoding (%d)", enc)
+	}
+	if err != nil {
+		return err
+	}
+	f.Data = dat
+	return nil
+}
+
+func appendRLE(out, dat []byte) []byte {
+	for i := 0; i < len(dat); {
+		j := i + 1
+		for j < len(dat) && dat[j] == dat[i] {
+			j++
+		}
+		out = binary.AppendUvarint(out, uint64(j-i))
+		out = append(out, dat[i])
+		i = j
+	}
+	return out
+}
+
+func decodeRLE(b []byte, size uint64) ([]byte, error) {
+	dat := make([]byte, 0, size)
+	for len(b) > 0 {
+		run, n := binary.Uvarint(b)
+		if n <= 0 || n >= len(b) {
+			return nil, fmt.Errorf("Truncated run-length encoded filter")
+		}
+		if run == 0 || run > size-uint64(len(dat)) {
+			return nil, fmt.Errorf("Run-length (%d) exceeds filter length (%d)", run, size)
+		}
+		v := b[n]
+		for i := uint64(0); i < run; i++ {
+			dat = append(dat, v)
+		}
+		b = b[n+1:]
+	}
+	if uint64(len(dat)) != size {
+		return nil, fmt.Errorf("Run-length encoded filter is short (%d of %d)", len(dat), size)
+	}
+	return dat, nil
+}
+
+// appendSparse writes the count followed by the gaps between the positions
+// of the set bits (or clear bits when inv is true).
+func appendSparse(out, dat []byte, count uint64, inv bool) []byte {
+	out = binary.AppendUvarint(out, count)
+	var next uint64
+	for i, v := range dat {
+		if inv {
+			v = ^v
+		}
+		for v != 0 {
+			pos := uint64(i)*8 + uint64(bits.TrailingZeros8(v))
+			out = binary.AppendUvarint(out, pos-next)
+			next = pos + 1
+			v &= v - 1
+		}
+	}
+	return out
+}
+
+func decodeSparse(b []byte, size uint64, inv bool) ([]byte, error) {
+	count, n := binary.Uvarint(b)
+	if n <= 0 {
+		return nil, fmt.Errorf("Truncated sparse filter")
+	}
+	b = b[n:]
+	if count > size*8 || count > uint64(len(b)) {
+		return nil, fmt.Errorf("Sparse filter count (%d) is invalid", count)
+	}
+	dat := make([]byte, size)
+	var next uint64
+	for i := uint64(0); i < count; i++ {
+		gap, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, fmt.Errorf("Truncated sparse filter")
+		}
+		b = b[n:]
+		if gap >= size*8-next {
+			return nil, fmt.Errorf("Sparse filter position out of range")
+		}
+		pos := next + gap
+		dat[pos>>3] |= 1 << (pos & 0x7)
+		next = pos + 1
+	}
+	if len(b) > 0 {
+		return nil, fmt.Errorf("Trailing data after sparse filter")
+	}
+	if inv {
+		for i := range dat {
+			dat[i] = ^dat[i]
+		}
+	}
+	return dat, nil
+}
+
+func uvarintLen(x uint64) int {
+	n := 1
+	for x >= 0x80 {
+		x >>= 7
+		n++
+	}
+	return n
+}
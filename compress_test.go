@@ -0,0 +1,113 @@
+package bwdb_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	bloom "github.com/pschou/go-bloom"
+)
+
+func ExampleFilter_MarshalCompressed() {
+	filter := bloom.Filter{make([]byte, 1<<24)}
+	filter.AddString("hello")
+	filter.AddString("world")
+
+	buf := filter.MarshalCompressed()
+	fmt.Println("compressed size:", len(buf))
+
+	var loaded bloom.Filter
+	if err := loaded.UnmarshalCompressed(buf); err != nil {
+		fmt.Println(err)
+	}
+	fmt.Println("loaded size:", len(loaded.Data))
+	fmt.Println("test", loaded.TestString("hello"))
+	// Output:
+	// compressed size: 14
+	// loaded size: 16777216
+	// test true
+}
+
+func TestMarshalCompressedFull(t *testing.T) {
+	filter := bloom.Filter{bytes.Repeat([]byte{0xff}, 4096)}
+	filter.Data[100] = 0xfe
+	buf := filter.MarshalCompressed()
+	if len(buf) > 16 {
+		t.Errorf("near-full filter encoded to %d bytes", len(buf))
+	}
+	var loaded bloom.Filter
+	if err := loaded.UnmarshalCompressed(buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(loaded.Data, filter.Data) {
+		t.Error("near-full filter did not round trip")
+	}
+}
+
+func FuzzMarshalCompressed(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{0, 0, 0, 0, 0, 1})
+	f.Add([]byte{0xff, 0xff, 0x7f, 0xff})
+	f.Add([]byte{1, 1, 1, 1, 2, 2, 2, 2, 3})
+	f.Add([]byte("a fairly random looking filter"))
+	f.Fuzz(func(t *testing.T, dat []byte) {
+		filter := bloom.Filter{dat}
+		buf := filter.MarshalCompressed()
+		if len(buf) > len(dat)+1+binary.MaxVarintLen64 {
+			t.Fatalf("encoding of %d bytes grew to %d", len(dat), len(buf))
+		}
+		var loaded bloom.Filter
+		if err := loaded.UnmarshalCompressed(buf); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(loaded.Data, dat) {
+			t.Fatalf("round trip mismatch: %x != %x", loaded.Data, dat)
+		}
+	})
+}
+
+func FuzzUnmarshalCompressed(f *testing.F) {
+	for _, dat := range [][]byte{{}, {0, 0, 0, 0}, {0xff, 0xff, 0xff, 0xfe}, {5, 5, 5, 7}} {
+		filter := bloom.Filter{dat}
+		f.Add(filter.MarshalCompressed())
+	}
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		var loaded bloom.Filter
+		if err := loaded.UnmarshalCompressedLimit(buf, 1<<20); err != nil {
+			return
+		}
+		if len(loaded.Data) > 1<<20 {
+			t.Fatalf("decoded %d bytes past the limit", len(loaded.Data))
+		}
+		again := loaded.MarshalCompressed()
+		var second bloom.Filter
+		if err := second.UnmarshalCompressed(again); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(loaded.Data, second.Data) {
+			t.Fatal("re-encoded filter does not match")
+		}
+	})
+}
+
+func TestUnmarshalCompressedLimit(t *testing.T) {
+	// A few bytes claiming a filter of almost 2^63 bytes
+	for _, enc := range []byte{0, 1, 2, 3} {
+		buf := binary.AppendUvarint([]byte{enc}, 1<<62)
+		var f bloom.Filter
+		if err := f.UnmarshalCompressed(append(buf, 1, 0)); err == nil {
+			t.Errorf("encoding %d: expected an error for a huge length", enc)
+		}
+	}
+
+	filter := bloom.Filter{make([]byte, 1000)}
+	buf := filter.MarshalCompressed()
+	var f bloom.Filter
+	if err := f.UnmarshalCompressedLimit(buf, 999); err == nil {
+		t.Error("expected an error past the limit")
+	}
+	if err := f.UnmarshalCompressedLimit(buf, 1000); err != nil || len(f.Data) != 1000 {
+		t.Errorf("unexpected error %v at the limit", err)
+	}
+}
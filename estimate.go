@@ -0,0 +1,136 @@
+// Copyright 2020 github.com/pschou/go-bloom-worm
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bwdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// EstimateCount estimates the number of distinct keys added to the filter
+// from the number of bits set.  With one bit per key, m bits of which X are
+// set hold about -m ln(1 - X/m) keys.  A full filter returns +Inf.
+func EstimateCount(f *Filter) float64 {
+	return estimate(len(f.Data)*8, popcount(f.Data))
+}
+
+// EstimateUnionSize estimates the number of distinct keys in either filter.
+// Filters of different sizes are compared by folding a copy of the larger
+// one down to the size of the smaller, which has to divide it evenly.  It
+// returns an error when the union has every bit set.
+func EstimateUnionSize(a, b *Filter) (float64, error) {
+	a, b, err := align(a, b)
+	if err != nil {
+		return 0, err
+	}
+	nu := estimate(len(a.Data)*8, popcountOr(a.Data, b.Data))
+	if math.IsInf(nu, 1) {
+		return 0, errSaturated
+	}
+	return nu, nil
+}
+
+// EstimateIntersectionSize estimates the number of distinct keys in both
+// filters as |A| + |B| - |A ∪ B|.  It returns an error when the union has
+// every bit set, as nothing can be said about the overlap then.
+func EstimateIntersectionSize(a, b *Filter) (float64, error) {
+	a, b, err := align(a, b)
+	if err != nil {
+		return 0, err
+	}
+	m := len(a.Data) * 8
+	nu := estimate(m, popcountOr(a.Data, b.Data))
+	if math.IsInf(nu, 1) {
+		return 0, errSaturated
+	}
+	na := estimate(m, popcount(a.Data))
+	nb := estimate(m, popcount(b.Data))
+	return math.Max(0, na+nb-nu), nil
+}
+
+// EstimateJaccard estimates |A ∩ B| / |A ∪ B|.  Two empty filters have a
+// similarity of 1, and a union with every bit set returns an error.
+func EstimateJaccard(a, b *Filter) (float64, error) {
+	a, b, err := align(a, b)
+	if err != nil {
+		return 0, err
+	}
+	m := len(a.Data) * 8
+	nu := estimate(m, popcountOr(a.Data, b.Data))
+	if nu == 0 {
+		return 1, nil
+	} else if math.IsInf(nu, 1) {
+		return 0, errSaturated
+	}
+	na := estimate(m, popcount(a.Data))
+	nb := estimate(m, popcount(b.Data))
+	return math.Min(1, math.Max(0, na+nb-nu)/nu), nil
+}
+
+// align returns the two filters at the same size, folding a copy of the
+// larger one when needed.
+func align(a, b *Filter) (*Filter, *Filter, error) {
+	if len(a.Data) == 0 || len(b.Data) == 0 {
+		return nil, nil, fmt.Errorf("Cannot compare an empty filter")
+	}
+	swapped := len(a.Data) < len(b.Data)
+	if swapped {
+		a, b = b, a
+	}
+	if len(a.Data) != len(b.Data) {
+		folded := &Filter{Data: a.Data}
+		if err := folded.Fold(len(a.Data) / len(b.Data)); err != nil {
+			return nil, nil, err
+		} else if len(folded.Data) != len(b.Data) {
+			return nil, nil, fmt.Errorf("Filter size (%d) is not a multiple of %d", len(a.Data), len(b.Data))
+		}
+		a = folded
+	}
+	if swapped {
+		a, b = b, a
+	}
+	return a, b, nil
+}
+
+var errSaturated = fmt.Errorf("Filters are saturated, every bit of the union is set")
+
+func estimate(m, x int) float64 {
+	if x >= m {
+		return math.Inf(1)
+	}
+	return -float64(m) * math.Log1p(-float64(x)/float64(m))
+}
+
+func popcount(d []byte) (n int) {
+	for ; len(d) >= 8; d = d[8:] {
+		n += bits.OnesCount64(binary.LittleEndian.Uint64(d))
+	}
+	for _, v := range d {
+		n += bits.OnesCount8(v)
+	}
+	return
+}
+
+func popcountOr(a, b []byte) (n int) {
+	for ; len(a) >= 8; a, b = a[8:], b[8:] {
+		n += bits.OnesCount64(binary.LittleEndian.Uint64(a) | binary.LittleEndian.Uint64(b))
+	}
+	for i := range a {
+		n += bits.OnesCount8(a[i] | b[i])
+	}
+	return
+}
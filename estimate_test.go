@@ -0,0 +1,92 @@
+package bwdb_test
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"testing"
+
+	bloom "github.com/pschou/go-bloom"
+)
+
+func ExampleEstimateJaccard() {
+	a := bloom.Filter{make([]byte, 1<<14)}
+	b := bloom.Filter{make([]byte, 1<<12)}
+	for i := 0; i < 3000; i++ {
+		a.AddString(strconv.Itoa(i))
+	}
+	for i := 1000; i < 4000; i++ {
+		b.AddString(strconv.Itoa(i))
+	}
+
+	// a is folded to the size of b before comparing
+	j, _ := bloom.EstimateJaccard(&a, &b)
+	fmt.Printf("jaccard %.1f\n", j)
+	// Output:
+	// jaccard 0.5
+}
+
+func TestEstimates(t *testing.T) {
+	a := bloom.Filter{make([]byte, 1<<15)}
+	b := bloom.Filter{make([]byte, 1<<15)}
+	for i := 0; i < 20000; i++ {
+		a.AddString(strconv.Itoa(i))
+	}
+	for i := 15000; i < 40000; i++ {
+		b.AddString(strconv.Itoa(i))
+	}
+
+	near := func(name string, got, want, tol float64) {
+		if math.Abs(got-want) > tol*want {
+			t.Errorf("%s = %.0f, want about %.0f", name, got, want)
+		}
+	}
+	near("count", bloom.EstimateCount(&a), 20000, 0.02)
+	u, err := bloom.EstimateUnionSize(&a, &b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	near("union", u, 40000, 0.02)
+	i, _ := bloom.EstimateIntersectionSize(&a, &b)
+	near("intersection", i, 5000, 0.1)
+	j, _ := bloom.EstimateJaccard(&a, &b)
+	near("jaccard", j*1000, 125, 0.1)
+
+	// Order and folding do not matter
+	small := bloom.Filter{append([]byte(nil), b.Data...)}
+	small.Fold(2)
+	j2, err := bloom.EstimateJaccard(&small, &a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	near("folded jaccard", j2*1000, 125, 0.15)
+	if len(a.Data) != 1<<15 {
+		t.Error("the larger filter was modified")
+	}
+
+	if _, err := bloom.EstimateJaccard(&a, &bloom.Filter{make([]byte, 3)}); err == nil {
+		t.Error("expected an error for sizes that do not fold")
+	}
+	empty := bloom.Filter{make([]byte, 64)}
+	if j, _ := bloom.EstimateJaccard(&empty, &empty); j != 1 {
+		t.Errorf("empty filters have jaccard %v", j)
+	}
+	if !math.IsInf(bloom.EstimateCount(&bloom.Filter{[]byte{0xff}}), 1) {
+		t.Error("a full filter should estimate +Inf")
+	}
+
+	// A full union is an error rather than +Inf, or NaN from Inf - Inf
+	full := bloom.Filter{[]byte{0xff, 0xff}}
+	half := bloom.Filter{[]byte{0xff, 0x00}}
+	for _, pair := range [][2]*bloom.Filter{{&full, &full}, {&full, &empty}, {&half, {[]byte{0x00, 0xff}}}} {
+		if u, err := bloom.EstimateUnionSize(pair[0], pair[1]); err == nil {
+			t.Errorf("saturated union %x, %x = %v", pair[0].Data, pair[1].Data, u)
+		}
+		if i, err := bloom.EstimateIntersectionSize(pair[0], pair[1]); err == nil {
+			t.Errorf("saturated intersection %x, %x = %v", pair[0].Data, pair[1].Data, i)
+		}
+		if j, err := bloom.EstimateJaccard(pair[0], pair[1]); err == nil {
+			t.Errorf("saturated jaccard %x, %x = %v", pair[0].Data, pair[1].Data, j)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package bwdb
+
+import (
+	"errors"
+	"io"
+)
+
+// FailLog makes the next write to the log of p store only its first n
+// bytes and fail, and with failTruncate also makes cutting the log fail.
+func FailLog(p *PersistentFilter, n int, failTruncate bool) {
+	p.wal = &faultyWAL{walFile: p.wal, n: n, failTruncate: failTruncate}
+}
+
+type faultyWAL struct {
+	walFile
+	n            int
+	failTruncate bool
+}
+
+func (w *faultyWAL) Write(b []byte) (int, error) {
+	if w.n < 0 {
+		return w.walFile.Write(b)
+	}
+	n, _ := w.walFile.Write(b[:w.n])
+	w.n = -1
+	return n, io.ErrShortWrite
+}
+
+func (w *faultyWAL) Truncate(size int64) error {
+	if w.failTruncate {
+		w.failTruncate = false
+		return errors.New("truncate failed")
+	}
+	return w.walFile.Truncate(size)
+}
@@ -0,0 +1,210 @@
+// Copyright 2020 github.com/pschou/go-bloom-worm
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Read, write, and probe filters in the serialized form of Guava's
+// com.google.common.hash.BloomFilter.
+
+package guava
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/pschou/go-bloom/internal/murmur3"
+)
+
+// Strategy is the ordinal of Guava's BloomFilterStrategies enum.
+type Strategy byte
+
+const (
+	Murmur128Mitz32 Strategy = 0
+	Murmur128Mitz64 Strategy = 1
+)
+
+// Filter mirrors a Guava BloomFilter.  Data holds the bit array as Java
+// longs, with bit i stored at Data[i/64] & (1 << (i%64)).
+//
+// Keys are funneled the way Guava's Funnels do it: strings are hashed as
+// their UTF-8 bytes (Funnels.stringFunnel(UTF_8)), byte slices as-is
+// (Funnels.byteArrayFunnel()), and longs as 8 little-endian bytes
+// (Funnels.longFunnel()).
+type Filter struct {
+	Strategy         Strategy
+	NumHashFunctions int
+	Data             []uint64
+}
+
+// New sizes a filter the way BloomFilter.create(funnel, expectedInsertions,
+// fpp) does, using the MURMUR128_MITZ_64 strategy.  Like Guava it rejects a
+// negative expectedInsertions and an fpp outside (0, 1).
+func New(expectedInsertions int64, fpp float64) (*Filter, error) {
+	if expectedInsertions < 0 {
+		return nil, fmt.Errorf("Expected insertions (%d) must be >= 0", expectedInsertions)
+	} else if !(fpp > 0) {
+		return nil, fmt.Errorf("False positive probability (%v) must be > 0.0", fpp)
+	} else if !(fpp < 1) {
+		return nil, fmt.Errorf("False positive probability (%v) must be < 1.0", fpp)
+	}
+	if expectedInsertions == 0 {
+		expectedInsertions = 1
+	}
+	n := float64(expectedInsertions)
+	numBits := int64(-n * math.Log(fpp) / (math.Ln2 * math.Ln2))
+	if numBits < 1 || (numBits+63)/64 > math.MaxInt32 {
+		return nil, fmt.Errorf("Bit array of %d bits is too large for Guava", numBits)
+	}
+	k := int(math.Round(float64(numBits) / n * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &Filter{
+		Strategy:         Murmur128Mitz64,
+		NumHashFunctions: k,
+		Data:             make([]uint64, (numBits+63)/64),
+	}, nil
+}
+
+// ReadFrom reads a filter written by Guava's BloomFilter.writeTo: the
+// strategy ordinal byte, the unsigned number of hash functions byte, a
+// big-endian int count of longs, and the big-endian longs.
+func ReadFrom(r io.Reader) (*Filter, error) {
+	var hdr [6]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, fmt.Errorf("Reading Guava header: %w", err)
+	}
+	f := &Filter{
+		Strategy:         Strategy(hdr[0]),
+		NumHashFunctions: int(hdr[1]),
+	}
+	if f.Strategy > Murmur128Mitz64 {
+		return nil, fmt.Errorf("Unknown Guava strategy ordinal (%d)", hdr[0])
+	}
+	n := int32(binary.BigEndian.Uint32(hdr[2:]))
+	if n < 0 {
+		return nil, fmt.Errorf("Guava data length (%d) is negative", n)
+	}
+
+	// Grow as the data arrives rather than trusting the length up front
+	var buf [8 * 512]byte
+	for remain := int(n); remain > 0; {
+		chunk := remain
+		if chunk > 512 {
+			chunk = 512
+		}
+		if _, err := io.ReadFull(r, buf[:chunk*8]); err != nil {
+			return nil, fmt.Errorf("Reading Guava bit array: %w", err)
+		}
+		for i := 0; i < chunk; i++ {
+			f.Data = append(f.Data, binary.BigEndian.Uint64(buf[i*8:]))
+		}
+		remain -= chunk
+	}
+	return f, nil
+}
+
+// WriteTo writes the filter in the form read by Guava's BloomFilter.readFrom.
+func (f *Filter) WriteTo(w io.Writer) (int64, error) {
+	if f.NumHashFunctions < 0 || f.NumHashFunctions > 255 {
+		return 0, fmt.Errorf("Number of hash functions (%d) does not fit in a byte", f.NumHashFunctions)
+	} else if len(f.Data) > math.MaxInt32 {
+		return 0, fmt.Errorf("Bit array of %d longs is too large for Guava", len(f.Data))
+	}
+	buf := make([]byte, 6, 6+8*len(f.Data))
+	buf[0] = byte(f.Strategy)
+	buf[1] = byte(f.NumHashFunctions)
+	binary.BigEndian.PutUint32(buf[2:], uint32(len(f.Data)))
+	for _, v := range f.Data {
+		buf = binary.BigEndian.AppendUint64(buf, v)
+	}
+	n, err := w.Write(buf)
+	return int64(n), err
+}
+
+// probe calls fn with each bit index for the hashed key, stopping early when
+// fn returns false.
+func (f *Filter) probe(key []byte, fn func(idx uint64) bool) {
+	bitSize := uint64(len(f.Data)) * 64
+	if bitSize == 0 {
+		return
+	}
+	h1, h2 := murmur3.Sum128(key, 0)
+	switch f.Strategy {
+	case Murmur128Mitz32:
+		hash1, hash2 := int32(h1), int32(h1>>32)
+		for i := int32(1); i <= int32(f.NumHashFunctions); i++ {
+			combined := hash1 + i*hash2
+			if combined < 0 {
+				combined = ^combined
+			}
+			if !fn(uint64(combined) % bitSize) {
+				return
+			}
+		}
+	default:
+		combined := h1
+		for i := 0; i < f.NumHashFunctions; i++ {
+			if !fn((combined & math.MaxInt64) % bitSize) {
+				return
+			}
+			combined += h2
+		}
+	}
+}
+
+// Add a byte slice to the filter, returning true if any bit changed
+func (f *Filter) Add(d []byte) (changed bool) {
+	f.probe(d, func(idx uint64) bool {
+		mask := uint64(1) << (idx & 63)
+		changed = changed || f.Data[idx>>6]&mask == 0
+		f.Data[idx>>6] |= mask
+		return true
+	})
+	return
+}
+
+// Test if a byte slice may be in the filter
+func (f *Filter) Test(d []byte) bool {
+	hit := len(f.Data) > 0
+	f.probe(d, func(idx uint64) bool {
+		hit = f.Data[idx>>6]&(1<<(idx&63)) != 0
+		return hit
+	})
+	return hit
+}
+
+// Add a string to the filter, returning true if any bit changed
+func (f *Filter) AddString(s string) bool {
+	return f.Add([]byte(s))
+}
+
+// Test if the string may be in the filter
+func (f *Filter) TestString(s string) bool {
+	return f.Test([]byte(s))
+}
+
+// Add a long to the filter, returning true if any bit changed
+func (f *Filter) AddLong(v int64) bool {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], uint64(v))
+	return f.Add(b[:])
+}
+
+// Test if a long may be in the filter
+func (f *Filter) TestLong(v int64) bool {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], uint64(v))
+	return f.Test(b[:])
+}
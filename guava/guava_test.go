@@ -0,0 +1,157 @@
+package guava_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/pschou/go-bloom/guava"
+)
+
+func ExampleReadFrom() {
+	// A Guava MURMUR128_MITZ_64 filter holding "hell"
+	dump, _ := hex.DecodeString("01020000000100004080" + "00000000")
+	filter, err := guava.ReadFrom(bytes.NewReader(dump))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println("test", filter.TestString("hell"), filter.TestString("hello"))
+	// Output:
+	// test true false
+}
+
+// The expected bit arrays are worked out by hand from Guava's strategies and
+// the published murmur3_128 vector for "hell" (0x629942693e10f867,
+// 0x92db0b82baeb5347); TestKnownFalsePositives checks against Guava itself.
+func TestStrategies(t *testing.T) {
+	for _, tc := range []struct {
+		strategy guava.Strategy
+		k        int
+		want     string
+	}{
+		{guava.Murmur128Mitz64, 2, "010200000001" + "0000408000000000"},
+		{guava.Murmur128Mitz32, 3, "000300000001" + "0200800400000000"},
+	} {
+		filter := &guava.Filter{Strategy: tc.strategy, NumHashFunctions: tc.k, Data: make([]uint64, 1)}
+		if !filter.AddString("hell") {
+			t.Error("first add reported no change")
+		}
+		if filter.AddString("hell") {
+			t.Error("second add reported a change")
+		}
+		var buf bytes.Buffer
+		if _, err := filter.WriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if got := hex.EncodeToString(buf.Bytes()); got != tc.want {
+			t.Errorf("strategy %d: wrote %s, want %s", tc.strategy, got, tc.want)
+		}
+	}
+}
+
+func TestNewRoundTrip(t *testing.T) {
+	filter, err := guava.New(1000, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.NumHashFunctions != 7 || len(filter.Data) != 150 {
+		t.Errorf("sized to k=%d longs=%d, want k=7 longs=150", filter.NumHashFunctions, len(filter.Data))
+	}
+	for i := int64(0); i < 1000; i++ {
+		filter.AddLong(i)
+	}
+	filter.AddString("hello")
+	filter.Add([]byte{1, 2, 3})
+
+	var buf bytes.Buffer
+	filter.WriteTo(&buf)
+	loaded, err := guava.ReadFrom(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); i < 1000; i++ {
+		if !loaded.TestLong(i) {
+			t.Fatalf("missing long %d", i)
+		}
+	}
+	if !loaded.TestString("hello") || !loaded.Test([]byte{1, 2, 3}) {
+		t.Error("missing string or bytes")
+	}
+
+	if _, err := guava.ReadFrom(bytes.NewReader([]byte{1, 2, 0, 0, 0, 2, 0})); err == nil {
+		t.Error("expected an error for a truncated bit array")
+	}
+	if _, err := guava.ReadFrom(bytes.NewReader([]byte{9, 2, 0, 0, 0, 0})); err == nil {
+		t.Error("expected an error for an unknown strategy")
+	}
+}
+
+// unencodedChars funnels an ASCII string like Funnels.unencodedCharsFunnel(),
+// as little-endian UTF-16 chars.
+func unencodedChars(s string) []byte {
+	b := make([]byte, 0, 2*len(s))
+	for i := 0; i < len(s); i++ {
+		b = append(b, s[i], 0)
+	}
+	return b
+}
+
+// The known false positives from Guava's BloomFilterTest
+// (testCreateAndCheckMitz32BloomFilterWithKnownFalsePositives,
+// testCreateAndCheckBloomFilterWithKnownFalsePositives64 and
+// testCreateAndCheckBloomFilterWithKnownUtf8FalsePositives64), which Guava
+// produced for create(funnel, 1000000, 0.03) holding the even numbers.
+// Matching them pins the sizing, both strategies and the funnels to Guava.
+func TestKnownFalsePositives(t *testing.T) {
+	for _, tc := range []struct {
+		strategy guava.Strategy
+		funnel   func(string) []byte
+		under900 []int
+		total    int
+	}{
+		{guava.Murmur128Mitz32, unencodedChars, []int{49, 51, 59, 163, 199, 321, 325, 363, 367, 469, 545, 561, 727, 769, 773, 781}, 29824},
+		{guava.Murmur128Mitz64, unencodedChars, []int{15, 25, 287, 319, 381, 399, 421, 465, 529, 697, 767, 857}, 30104},
+		{guava.Murmur128Mitz64, func(s string) []byte { return []byte(s) }, []int{89, 129, 471, 723, 751, 835, 871}, 29763},
+	} {
+		const n = 1000000
+		filter, _ := guava.New(n, 0.03)
+		filter.Strategy = tc.strategy
+		for i := 0; i < 2*n; i += 2 {
+			filter.Add(tc.funnel(strconv.Itoa(i)))
+		}
+		var under900 []int
+		total := 0
+		for i := 1; i < 2*n; i += 2 {
+			if filter.Test(tc.funnel(strconv.Itoa(i))) {
+				total++
+				if i < 900 {
+					under900 = append(under900, i)
+				}
+			}
+		}
+		if fmt.Sprint(under900) != fmt.Sprint(tc.under900) || total != tc.total {
+			t.Errorf("strategy %d: false positives %v (%d in total), want %v (%d)",
+				tc.strategy, under900, total, tc.under900, tc.total)
+		}
+	}
+}
+
+func TestNewArguments(t *testing.T) {
+	for _, tc := range []struct {
+		n   int64
+		fpp float64
+	}{
+		{-1, 0.01}, {1000, 0}, {1000, 1}, {1000, 2}, {1000, -0.5}, {1000, math.NaN()}, {math.MaxInt64, 1e-9},
+	} {
+		if _, err := guava.New(tc.n, tc.fpp); err == nil {
+			t.Errorf("New(%d, %v): expected an error", tc.n, tc.fpp)
+		}
+	}
+	if f, err := guava.New(0, 0.5); err != nil || len(f.Data) != 1 {
+		t.Errorf("New(0, 0.5) = %v, %v", f, err)
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2020 github.com/pschou/go-bloom-worm
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// MurmurHash3 x64 128-bit, as used by other bloom filter implementations.
+
+package murmur3
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+const (
+	c1 = 0x87c37b91114253d5
+	c2 = 0x4cf5ad432745937f
+)
+
+// Sum128 returns the two 64-bit halves of the MurmurHash3_x64_128 hash of
+// data with the given seed.
+func Sum128(data []byte, seed uint32) (h1, h2 uint64) {
+	return Sum128Tail(data, nil, seed)
+}
+
+// Sum128Tail hashes data followed by tail without copying them together.
+func Sum128Tail(data, tail []byte, seed uint32) (h1, h2 uint64) {
+	h1, h2 = uint64(seed), uint64(seed)
+	length := len(data) + len(tail)
+
+	nblocks := len(data) / 16
+	for i := 0; i < nblocks; i++ {
+		h1, h2 = block(h1, h2, data[i*16:])
+	}
+	rest := data[nblocks*16:]
+
+	var buf [16]byte
+	for len(tail) > 0 {
+		n := copy(buf[len(rest):], tail)
+		tail = tail[n:]
+		rest = buf[:copy(buf[:], rest)+n]
+		if len(rest) < 16 {
+			break
+		}
+		h1, h2 = block(h1, h2, rest)
+		rest = nil
+	}
+
+	var k1, k2 uint64
+	switch len(rest) & 15 {
+	case 15:
+		k2 ^= uint64(rest[14]) << 48
+		fallthrough
+	case 14:
+		k2 ^= uint64(rest[13]) << 40
+		fallthrough
+	case 13:
+		k2 ^= uint64(rest[12]) << 32
+		fallthrough
+	case 12:
+		k2 ^= uint64(rest[11]) << 24
+		fallthrough
+	case 11:
+		k2 ^= uint64(rest[10]) << 16
+		fallthrough
+	case 10:
+		k2 ^= uint64(rest[9]) << 8
+		fallthrough
+	case 9:
+		k2 ^= uint64(rest[8])
+		k2 *= c2
+		k2 = bits.RotateLeft64(k2, 33)
+		k2 *= c1
+		h2 ^= k2
+		fallthrough
+	case 8:
+		k1 ^= uint64(rest[7]) << 56
+		fallthrough
+	case 7:
+		k1 ^= uint64(rest[6]) << 48
+		fallthrough
+	case 6:
+		k1 ^= uint64(rest[5]) << 40
+		fallthrough
+	case 5:
+		k1 ^= uint64(rest[4]) << 32
+		fallthrough
+	case 4:
+		k1 ^= uint64(rest[3]) << 24
+		fallthrough
+	case 3:
+		k1 ^= uint64(rest[2]) << 16
+		fallthrough
+	case 2:
+		k1 ^= uint64(rest[1]) << 8
+		fallthrough
+	case 1:
+		k1 ^= uint64(rest[0])
+		k1 *= c1
+		k1 = bits.RotateLeft64(k1, 31)
+		k1 *= c2
+		h1 ^= k1
+	}
+
+	h1 ^= uint64(length)
+	h2 ^= uint64(length)
+	h1 += h2
+	h2 += h1
+	h1 = fmix(h1)
+	h2 = fmix(h2)
+	h1 += h2
+	h2 += h1
+	return h1, h2
+}
+
+func block(h1, h2 uint64, b []byte) (uint64, uint64) {
+	k1 := binary.LittleEndian.Uint64(b)
+	k2 := binary.LittleEndian.Uint64(b[8:])
+
+	k1 *= c1
+	k1 = bits.RotateLeft64(k1, 31)
+	k1 *= c2
+	h1 ^= k1
+	h1 = bits.RotateLeft64(h1, 27)
+	h1 += h2
+	h1 = h1*5 + 0x52dce729
+
+	k2 *= c2
+	k2 = bits.RotateLeft64(k2, 33)
+	k2 *= c1
+	h2 ^= k2
+	h2 = bits.RotateLeft64(h2, 31)
+	h2 += h1
+	h2 = h2*5 + 0x38495ab5
+	return h1, h2
+}
+
+func fmix(k uint64) uint64 {
+	k ^= k >> 33
+	k *= 0xff51afd7ed558ccd
+	k ^= k >> 33
+	k *= 0xc4ceb9fe1a85ec53
+	k ^= k >> 33
+	return k
+}
@@ -0,0 +1,39 @@
+package murmur3
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSum128(t *testing.T) {
+	for _, tc := range []struct {
+		in     string
+		h1, h2 uint64
+	}{
+		{"", 0, 0},
+		{"hell", 0x629942693e10f867, 0x92db0b82baeb5347},
+		{"The quick brown fox jumps over the lazy dog", 0xe34bbc7bbc071b6c, 0x7a433ca9c49a9347},
+		{"The quick brown fox jumps over the lazy cog", 0x658ca970ff85269a, 0x43fee3eaa68e5c3e},
+	} {
+		h1, h2 := Sum128([]byte(tc.in), 0)
+		if h1 != tc.h1 || h2 != tc.h2 {
+			t.Errorf("Sum128(%q) = %016x %016x, want %016x %016x", tc.in, h1, h2, tc.h1, tc.h2)
+		}
+	}
+}
+
+func TestSum128Tail(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 10)
+	for i := 0; i <= len(data); i++ {
+		for _, j := range []int{0, 1, 15, 16, 17, 40} {
+			if i+j > len(data) {
+				continue
+			}
+			w1, w2 := Sum128(data[:i+j], 7)
+			h1, h2 := Sum128Tail(data[:i], data[i:i+j], 7)
+			if h1 != w1 || h2 != w2 {
+				t.Fatalf("split %d+%d: %x %x, want %x %x", i, j, h1, h2, w1, w2)
+			}
+		}
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2020 github.com/pschou/go-bloom-worm
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bwdb
+
+import (
+	zxxh3 "github.com/zeebo/xxh3"
+)
+
+// A KeyWriter hashes a key as it is written, so large values can be added to
+// or tested against a filter without holding them in memory.  The bits used
+// are identical to calling Add on the concatenation of all the writes.
+type KeyWriter struct {
+	f *Filter
+	h *zxxh3.Hasher
+}
+
+// NewKeyWriter returns a KeyWriter that adds to or tests against f.
+func (f *Filter) NewKeyWriter() *KeyWriter {
+	return &KeyWriter{f: f, h: zxxh3.New()}
+}
+
+// Write appends p to the key.  It never returns an error.
+func (w *KeyWriter) Write(p []byte) (int, error) {
+	return w.h.Write(p)
+}
+
+// WriteString appends s to the key.  It never returns an error.
+func (w *KeyWriter) WriteString(s string) (int, error) {
+	return w.h.WriteString(s)
+}
+
+// Commit adds the key written so far to the filter
+func (w *KeyWriter) Commit() (hash uint64) {
+	hash = w.h.Sum64()
+	w.f.add(hash)
+	return
+}
+
+// Check if the key written so far may be in the filter
+func (w *KeyWriter) Check() bool {
+	return w.f.test(w.h.Sum64())
+}
+
+// Reset discards the key written so far to start a new one.
+func (w *KeyWriter) Reset() {
+	w.h.Reset()
+}
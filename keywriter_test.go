@@ -0,0 +1,53 @@
+package bwdb_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	bloom "github.com/pschou/go-bloom"
+)
+
+func ExampleFilter_NewKeyWriter() {
+	filter := bloom.Filter{make([]byte, 100)}
+
+	w := filter.NewKeyWriter()
+	io.Copy(w, strings.NewReader("hello"))
+	w.Commit()
+
+	fmt.Println("test", filter.TestString("hello"))
+	// Output:
+	// test true
+}
+
+func TestKeyWriterMatchesAdd(t *testing.T) {
+	// Cover the short, mid-size, and streamed block paths of xxh3
+	for _, n := range []int{0, 1, 16, 17, 128, 129, 240, 241, 1024, 1 << 20} {
+		blob := bytes.Repeat([]byte("0123456789abcdef"), n/16+1)[:n]
+
+		filter := bloom.Filter{make([]byte, 1<<10)}
+		w := filter.NewKeyWriter()
+		for rest := blob; len(rest) > 0; {
+			chunk := 1000
+			if chunk > len(rest) {
+				chunk = len(rest)
+			}
+			w.Write(rest[:chunk])
+			rest = rest[chunk:]
+		}
+		if got, want := w.Commit(), (&bloom.Filter{make([]byte, 1)}).Add(blob); got != want {
+			t.Errorf("len %d: streamed hash %x, want %x", n, got, want)
+		}
+		if !filter.Test(blob) {
+			t.Errorf("len %d: committed key not found", n)
+		}
+
+		w.Reset()
+		w.Write(blob)
+		if !w.Check() {
+			t.Errorf("len %d: check after reset failed", n)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2020 github.com/pschou/go-bloom-worm
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// LevelDB's built-in bloom filter policy, producing filter blocks that
+// LevelDB and RocksDB's legacy bloom format can read.
+
+package leveldb
+
+import (
+	"encoding/binary"
+)
+
+// BloomPolicy mirrors LevelDB's NewBloomFilterPolicy(bits_per_key).
+type BloomPolicy struct {
+	bitsPerKey int
+	k          int
+}
+
+// NewBloomPolicy creates a policy using about bitsPerKey bits per key.
+func NewBloomPolicy(bitsPerKey int) *BloomPolicy {
+	// Round down to reduce probing cost a little bit
+	k := bitsPerKey * 69 / 100 // 0.69 =~ ln(2)
+	if k < 1 {
+		k = 1
+	} else if k > 30 {
+		k = 30
+	}
+	return &BloomPolicy{bitsPerKey: bitsPerKey, k: k}
+}
+
+// Name is the policy name LevelDB records in the metaindex block.
+func (p *BloomPolicy) Name() string {
+	return "leveldb.BuiltinBloomFilter2"
+}
+
+// CreateFilter appends a filter for keys to dst.  The filter is the bit
+// array followed by one byte holding the number of probes.
+func (p *BloomPolicy) CreateFilter(keys [][]byte, dst []byte) []byte {
+	bits := len(keys) * p.bitsPerKey
+
+	// For small n, we can see a very high false positive rate.  Fix it
+	// by enforcing a minimum bloom filter length.
+	if bits < 64 {
+		bits = 64
+	}
+	bytes := (bits + 7) / 8
+	bits = bytes * 8
+
+	start := len(dst)
+	dst = append(dst, make([]byte, bytes+1)...)
+	array := dst[start:]
+	array[bytes] = byte(p.k)
+	for _, key := range keys {
+		// Use double-hashing to generate a sequence of hash values
+		h := bloomHash(key)
+		delta := h>>17 | h<<15 // Rotate right 17 bits
+		for j := 0; j < p.k; j++ {
+			bitpos := h % uint32(bits)
+			array[bitpos/8] |= 1 << (bitpos % 8)
+			h += delta
+		}
+	}
+	return dst
+}
+
+// KeyMayMatch reports if key may be in a filter made by CreateFilter.  The
+// number of probes is read from the filter, so filters made with other
+// bits-per-key settings are understood.
+func (p *BloomPolicy) KeyMayMatch(key, filter []byte) bool {
+	if len(filter) < 2 {
+		return false
+	}
+	bits := uint32(len(filter)-1) * 8
+
+	k := filter[len(filter)-1]
+	if k > 30 {
+		// Reserved for potentially new encodings for short bloom filters.
+		// Consider it a match.
+		return true
+	}
+
+	h := bloomHash(key)
+	delta := h>>17 | h<<15 // Rotate right 17 bits
+	for j := byte(0); j < k; j++ {
+		bitpos := h % bits
+		if filter[bitpos/8]&(1<<(bitpos%8)) == 0 {
+			return false
+		}
+		h += delta
+	}
+	return true
+}
+
+func bloomHash(key []byte) uint32 {
+	return Hash(key, 0xbc9f1d34)
+}
+
+// Hash is LevelDB's murmur-like hash from util/hash.cc.
+func Hash(data []byte, seed uint32) uint32 {
+	const m = 0xc6a4a793
+	const r = 24
+	h := seed ^ uint32(len(data))*m
+
+	for ; len(data) >= 4; data = data[4:] {
+		h += binary.LittleEndian.Uint32(data)
+		h *= m
+		h ^= h >> 16
+	}
+
+	switch len(data) {
+	case 3:
+		h += uint32(data[2]) << 16
+		fallthrough
+	case 2:
+		h += uint32(data[1]) << 8
+		fallthrough
+	case 1:
+		h += uint32(data[0])
+		h *= m
+		h ^= h >> r
+	}
+	return h
+}
@@ -0,0 +1,125 @@
+package leveldb_test
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/pschou/go-bloom/leveldb"
+)
+
+func ExampleBloomPolicy() {
+	policy := leveldb.NewBloomPolicy(10)
+	filter := policy.CreateFilter([][]byte{[]byte("hello"), []byte("world")}, nil)
+	fmt.Printf("%x\n", filter)
+	fmt.Println(policy.KeyMayMatch([]byte("hello"), filter), policy.KeyMayMatch([]byte("foo"), filter))
+	// Output:
+	// 114000414410401006
+	// true false
+}
+
+// Vectors from LevelDB's util/hash_test.cc.
+func TestHash(t *testing.T) {
+	data5 := []byte{
+		0x01, 0xc0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x14, 0x00, 0x00, 0x00, 0x00, 0x00, 0x04, 0x00,
+		0x00, 0x00, 0x00, 0x14, 0x00, 0x00, 0x00, 0x18,
+		0x28, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	}
+	for i, tc := range []struct {
+		data       []byte
+		seed, want uint32
+	}{
+		{nil, 0xbc9f1d34, 0xbc9f1d34},
+		{[]byte{0x62}, 0xbc9f1d34, 0xef1345c4},
+		{[]byte{0xc3, 0x97}, 0xbc9f1d34, 0x5b663814},
+		{[]byte{0xe2, 0x99, 0xa5}, 0xbc9f1d34, 0x323c078f},
+		{[]byte{0xe1, 0x80, 0xb9, 0x32}, 0xbc9f1d34, 0xed21633a},
+		{data5, 0x12345678, 0xf333dabb},
+	} {
+		if got := leveldb.Hash(tc.data, tc.seed); got != tc.want {
+			t.Errorf("vector %d: hash %#x, want %#x", i, got, tc.want)
+		}
+	}
+}
+
+// Filter blocks written by the C++ LevelDB (commit 4fb146810cd2), from a
+// small program linking util/bloom.cc that calls CreateFilter with the same
+// keys on a dst of "prefix" and prints the appended bytes.
+func TestCreateFilter(t *testing.T) {
+	var many []string
+	for i := 0; i < 100; i++ {
+		many = append(many, fmt.Sprintf("key%d", i))
+	}
+
+	for _, tc := range []struct {
+		bitsPerKey int
+		keys       []string
+		want       string
+	}{
+		{10, []string{"hello", "world"}, "114000414410401006"},
+		{10, nil, "000000000000000006"},
+		{16, []string{"a", "bb", "ccc", "dddd", "eeeee", "key-with-more-bytes"}, "321992f2b99173359132b9930b"},
+		{10, many, "5bd655316edc0151b6108f43d863152ef2db9ff05317d72e8b0a845f728065c11b60ace35f004267f33154e188433318ef463d9f1d5df406432a5aa198df05903a1b63106cfc61158c78832891fed020739c29b4c807668ec40b1cb3412588718742c661724082479e73036d280304c68241463e65a415c57b10c3017c06"},
+		{3, []string{"x", "y", "z"}, "001040008001006002"},
+	} {
+		var keys [][]byte
+		for _, k := range tc.keys {
+			keys = append(keys, []byte(k))
+		}
+		policy := leveldb.NewBloomPolicy(tc.bitsPerKey)
+		filter := policy.CreateFilter(keys, []byte("prefix"))
+		if got := hex.EncodeToString(filter[6:]); got != tc.want {
+			t.Errorf("filter for %q: %s, want %s", tc.keys, got, tc.want)
+		}
+		for _, k := range keys {
+			if !policy.KeyMayMatch(k, filter[6:]) {
+				t.Errorf("key %q does not match", k)
+			}
+		}
+	}
+}
+
+// Mirrors the varying lengths test in LevelDB's bloom_test.cc.
+func TestVaryingLengths(t *testing.T) {
+	policy := leveldb.NewBloomPolicy(10)
+	if policy.KeyMayMatch([]byte("hello"), nil) {
+		t.Error("empty filter matched")
+	}
+	if !policy.KeyMayMatch([]byte("hello"), []byte{0, 31}) {
+		t.Error("reserved encoding did not match")
+	}
+
+	key := func(i int) []byte {
+		b := make([]byte, 4)
+		binary.LittleEndian.PutUint32(b, uint32(i))
+		return b
+	}
+	for _, n := range []int{1, 10, 100, 1000, 10000} {
+		var keys [][]byte
+		for i := 0; i < n; i++ {
+			keys = append(keys, key(i))
+		}
+		filter := policy.CreateFilter(keys, nil)
+		if len(filter) > n*10/8+40 {
+			t.Errorf("n=%d: filter is %d bytes", n, len(filter))
+		}
+		for i := 0; i < n; i++ {
+			if !policy.KeyMayMatch(key(i), filter) {
+				t.Fatalf("n=%d: key %d missing", n, i)
+			}
+		}
+		hits := 0
+		for i := 0; i < 10000; i++ {
+			if policy.KeyMayMatch(key(i+1000000000), filter) {
+				hits++
+			}
+		}
+		if rate := float64(hits) / 10000; rate > 0.02 {
+			t.Errorf("n=%d: false positive rate %.4f", n, rate)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2020 github.com/pschou/go-bloom-worm
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Bloom filters over IP networks, for checking addresses against block
+// lists that mix single addresses and CIDR ranges.
+
+package netfilter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"sort"
+	"strings"
+
+	bloom "github.com/pschou/go-bloom"
+)
+
+// Filter keeps one bloom.Filter per prefix length and address family.  A
+// network is stored as its masked address in the filter of its length, and
+// an address is tested by masking it to every length in use, so the false
+// positive rate grows with the number of distinct lengths.
+//
+// IPv4-mapped IPv6 addresses and networks are stored and tested as IPv4, and
+// zones are ignored.
+type Filter struct {
+	Size int // bytes per prefix length
+
+	v4 [33]*bloom.Filter
+	v6 [129]*bloom.Filter
+
+	lengths4, lengths6 []int
+}
+
+// New creates a filter using size bytes for every prefix length added.
+func New(size int) (*Filter, error) {
+	if size < 1 {
+		return nil, fmt.Errorf("Filter size (%d) has to be a positive value", size)
+	}
+	return &Filter{Size: size}, nil
+}
+
+// Add a network to the filter
+func (f *Filter) Add(p netip.Prefix) error {
+	if !p.IsValid() {
+		return fmt.Errorf("Invalid network %v", p)
+	} else if f.Size < 1 {
+		return fmt.Errorf("Filter size (%d) has to be a positive value", f.Size)
+	}
+	p = canonical(p)
+	var lvl **bloom.Filter
+	if p.Addr().Is4() {
+		lvl = &f.v4[p.Bits()]
+	} else {
+		lvl = &f.v6[p.Bits()]
+	}
+	if *lvl == nil {
+		*lvl = &bloom.Filter{Data: make([]byte, f.Size)}
+		if p.Addr().Is4() {
+			f.lengths4 = insertLength(f.lengths4, p.Bits())
+		} else {
+			f.lengths6 = insertLength(f.lengths6, p.Bits())
+		}
+	}
+	(*lvl).AddNetIP(p.Addr())
+	return nil
+}
+
+// AddAddr adds a single address to the filter
+func (f *Filter) AddAddr(a netip.Addr) error {
+	return f.Add(netip.PrefixFrom(a, a.BitLen()))
+}
+
+// Test if the address may be in one of the networks in the filter
+func (f *Filter) Test(a netip.Addr) bool {
+	a = a.Unmap().WithZone("")
+	lvls, lengths := f.v6[:], f.lengths6
+	if a.Is4() {
+		lvls, lengths = f.v4[:], f.lengths4
+	}
+	for _, n := range lengths {
+		p, err := a.Prefix(n)
+		if err == nil && lvls[n].TestNetIP(p.Addr()) {
+			return true
+		}
+	}
+	return false
+}
+
+// Lengths returns the IPv4 and IPv6 prefix lengths in use, longest first.
+func (f *Filter) Lengths() (v4, v6 []int) {
+	return append([]int(nil), f.lengths4...), append([]int(nil), f.lengths6...)
+}
+
+// Load adds a text list of networks, one per line in CIDR notation or as a
+// single address.  Blank lines and anything after a '#' are skipped.
+func (f *Filter) Load(r io.Reader) error {
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		text := s.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+		if text = strings.TrimSpace(text); text == "" {
+			continue
+		}
+		p, err := ParsePrefix(text)
+		if err == nil {
+			err = f.Add(p)
+		}
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	return s.Err()
+}
+
+// ParsePrefix parses a network in CIDR notation, or a single address as a
+// network of its full length.
+func ParsePrefix(s string) (netip.Prefix, error) {
+	if strings.IndexByte(s, '/') >= 0 {
+		return netip.ParsePrefix(s)
+	}
+	a, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(a.WithZone(""), a.BitLen()), nil
+}
+
+// canonical masks the network and moves IPv4-mapped networks to IPv4.
+func canonical(p netip.Prefix) netip.Prefix {
+	a := p.Addr().WithZone("")
+	if a.Is4In6() && p.Bits() >= 96 {
+		return netip.PrefixFrom(a.Unmap(), p.Bits()-96).Masked()
+	}
+	return netip.PrefixFrom(a, p.Bits()).Masked()
+}
+
+func insertLength(lengths []int, n int) []int {
+	lengths = append(lengths, n)
+	sort.Sort(sort.Reverse(sort.IntSlice(lengths)))
+	return lengths
+}
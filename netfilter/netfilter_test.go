@@ -0,0 +1,87 @@
+package netfilter_test
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/pschou/go-bloom/netfilter"
+)
+
+const blocklist = `
+# spam sources
+192.0.2.0/24
+198.51.100.7      # a single host
+203.0.113.128/25
+2001:db8:dead::/48
+2001:db8::1
+::ffff:100.64.0.0/106
+`
+
+func ExampleFilter() {
+	filter, _ := netfilter.New(1 << 12)
+	filter.Load(strings.NewReader(blocklist))
+
+	for _, s := range []string{"192.0.2.55", "198.51.100.8", "2001:db8:dead:beef::1"} {
+		fmt.Println(s, filter.Test(netip.MustParseAddr(s)))
+	}
+	// Output:
+	// 192.0.2.55 true
+	// 198.51.100.8 false
+	// 2001:db8:dead:beef::1 true
+}
+
+func TestFilter(t *testing.T) {
+	filter, err := netfilter.New(1 << 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := filter.Load(strings.NewReader(blocklist)); err != nil {
+		t.Fatal(err)
+	}
+	v4, v6 := filter.Lengths()
+	if fmt.Sprint(v4, v6) != "[32 25 24 10] [128 48]" {
+		t.Errorf("lengths %v %v", v4, v6)
+	}
+
+	for s, want := range map[string]bool{
+		"192.0.2.0":             true,
+		"192.0.2.255":           true,
+		"192.0.3.0":             false,
+		"198.51.100.7":          true,
+		"198.51.100.6":          false,
+		"203.0.113.200":         true,
+		"203.0.113.127":         false,
+		"::ffff:192.0.2.1":      true,
+		"100.127.255.255":       true,
+		"100.128.0.0":           false,
+		"2001:db8:dead:ffff::9": true,
+		"2001:db8:beef::1":      false,
+		"2001:db8::1":           true,
+		"fe80::1%eth0":          false,
+		"2001:db8::1%eth0":      true,
+	} {
+		if got := filter.Test(netip.MustParseAddr(s)); got != want {
+			t.Errorf("%s: got %v, want %v", s, got, want)
+		}
+	}
+
+	if err := filter.Load(strings.NewReader("10.0.0.0/8\n10.0.0.300\n")); err == nil || !strings.HasPrefix(err.Error(), "line 2:") {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := filter.Add(netip.Prefix{}); err == nil {
+		t.Error("expected an error for an invalid network")
+	}
+	if !filter.Test(netip.MustParseAddr("10.1.2.3")) {
+		t.Error("lines before the error were not loaded")
+	}
+
+	if _, err := netfilter.New(0); err == nil {
+		t.Error("expected an error for a zero size")
+	}
+	var zero netfilter.Filter
+	if err := zero.Load(strings.NewReader("10.0.0.0/8\n")); err == nil || !strings.HasPrefix(err.Error(), "line 1:") {
+		t.Errorf("unexpected error %v from a filter without a size", err)
+	}
+}
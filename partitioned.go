@@ -0,0 +1,121 @@
+// Copyright 2020 github.com/pschou/go-bloom-worm
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bwdb
+
+import (
+	"fmt"
+
+	zxxh3 "github.com/zeebo/xxh3"
+)
+
+// hashPair derives the two halves used for double hashing, where the ith
+// probe of a key is h1 + i*h2.
+func hashPair(d []byte) (h1, h2 uint64) {
+	h := zxxh3.Hash128(d)
+	return h.Lo, h.Hi
+}
+
+// A PartitionedFilter splits Data into K equal partitions and restricts the
+// ith hash of every key to the ith partition.  Within a partition a hash
+// picks its bit the same way a Filter does.
+type PartitionedFilter struct {
+	K    int
+	Data []byte
+}
+
+// NewPartitionedFilter creates a filter of k partitions of size bytes each.
+func NewPartitionedFilter(k, size int) (*PartitionedFilter, error) {
+	if k < 1 {
+		return nil, fmt.Errorf("Partition count (%d) has to be a positive value", k)
+	} else if size < 1 {
+		return nil, fmt.Errorf("Partition size (%d) has to be a positive value", size)
+	}
+	return &PartitionedFilter{K: k, Data: make([]byte, k*size)}, nil
+}
+
+// Test if the string may be in the filter
+func (f *PartitionedFilter) TestString(s string) bool {
+	return f.test(hashPair(s2b(s)))
+}
+
+// Test if a byte slice may be in the filter
+func (f *PartitionedFilter) Test(d []byte) bool {
+	return f.test(hashPair(d))
+}
+
+// Add a string to the filter
+func (f *PartitionedFilter) AddString(s string) {
+	f.add(hashPair(s2b(s)))
+}
+
+// Add a byte slice to the filter
+func (f *PartitionedFilter) Add(d []byte) {
+	f.add(hashPair(d))
+}
+
+func (f *PartitionedFilter) test(h1, h2 uint64) bool {
+	p := len(f.Data) / f.K
+	for i := 0; i < f.K; i++ {
+		hash := h1 + uint64(i)*h2
+		if f.Data[i*p+int(hash>>3)%p]&(1<<(hash&0x7)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *PartitionedFilter) add(h1, h2 uint64) {
+	p := len(f.Data) / f.K
+	for i := 0; i < f.K; i++ {
+		hash := h1 + uint64(i)*h2
+		f.Data[i*p+int(hash>>3)%p] |= 1 << (hash & 0x7)
+	}
+}
+
+// Fold will reduce the memory resident size by a factor n, folding each
+// partition on its own so the result stays partitioned.
+func (f *PartitionedFilter) Fold(n int) error {
+	p := len(f.Data) / f.K
+	if n == 1 { // Do nothing
+		return nil
+	} else if n < 1 {
+		return fmt.Errorf("Folding n (%d) has to be a positive value", n)
+	} else if p%n > 0 {
+		return fmt.Errorf("Folding n (%d) has to be a multiple of current partition size (%d)", n, p)
+	}
+	sz := p / n
+	dat := make([]byte, sz*f.K)
+	for i := 0; i < f.K; i++ {
+		part, out := f.Data[i*p:(i+1)*p], dat[i*sz:(i+1)*sz]
+		for j, v := range part {
+			out[j%sz] |= v
+		}
+	}
+	f.Data = dat
+	return nil
+}
+
+// Union merges the keys of o into f.  Both filters need the same number and
+// size of partitions.
+func (f *PartitionedFilter) Union(o *PartitionedFilter) error {
+	if f.K != o.K || len(f.Data) != len(o.Data) {
+		return fmt.Errorf("Partitioned filters differ in layout (%d x %d and %d x %d)",
+			f.K, len(f.Data)/f.K, o.K, len(o.Data)/o.K)
+	}
+	for i, v := range o.Data {
+		f.Data[i] |= v
+	}
+	return nil
+}
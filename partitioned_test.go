@@ -0,0 +1,72 @@
+package bwdb_test
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	bloom "github.com/pschou/go-bloom"
+)
+
+func ExamplePartitionedFilter() {
+	filter, _ := bloom.NewPartitionedFilter(4, 100)
+	filter.AddString("hello")
+
+	// Fold each partition in half
+	filter.Fold(2)
+	fmt.Println("size:", len(filter.Data))
+	fmt.Println("test", filter.TestString("hello"))
+	// Output:
+	// size: 200
+	// test true
+}
+
+func TestPartitionedFilter(t *testing.T) {
+	a, _ := bloom.NewPartitionedFilter(5, 1<<10)
+	b, _ := bloom.NewPartitionedFilter(5, 1<<10)
+	for i := 0; i < 500; i++ {
+		a.AddString(strconv.Itoa(i))
+		b.Add([]byte(strconv.Itoa(i + 500)))
+	}
+	if err := a.Union(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Fold(4); err != nil {
+		t.Fatal(err)
+	}
+	if len(a.Data) != 5*256 {
+		t.Fatalf("folded size %d", len(a.Data))
+	}
+	for i := 0; i < 1000; i++ {
+		if !a.TestString(strconv.Itoa(i)) {
+			t.Fatalf("missing key %d", i)
+		}
+	}
+
+	// Every key sets exactly one bit per partition
+	c, _ := bloom.NewPartitionedFilter(3, 64)
+	c.AddString("x")
+	for i := 0; i < 3; i++ {
+		if n := (&bloom.Filter{Data: c.Data[i*64 : (i+1)*64]}).FillRatio() * 512; n != 1 {
+			t.Errorf("partition %d has %v bits set", i, n)
+		}
+	}
+
+	if err := a.Fold(3); err == nil {
+		t.Error("expected an error for a fold that does not divide the partitions")
+	}
+	if err := a.Union(c); err == nil {
+		t.Error("expected an error for a union of different layouts")
+	}
+	if _, err := bloom.NewPartitionedFilter(0, 10); err == nil {
+		t.Error("expected an error for zero partitions")
+	}
+}
+
+func BenchmarkPartitionedTest(b *testing.B) {
+	dat := []byte("helloworld")
+	filter, _ := bloom.NewPartitionedFilter(7, 1<<21)
+	for n := 0; n < b.N; n++ {
+		filter.Test(dat)
+	}
+}
@@ -0,0 +1,298 @@
+// Copyright 2020 github.com/pschou/go-bloom-worm
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bwdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	zxxh3 "github.com/zeebo/xxh3"
+)
+
+// SyncPolicy controls when a PersistentFilter fsyncs its write-ahead log.
+type SyncPolicy int
+
+const (
+	SyncAlways   SyncPolicy = iota // fsync after every add
+	SyncInterval                   // fsync when SyncInterval has passed since the last one
+	SyncNever                      // leave it to the OS, or explicit calls to Sync
+)
+
+// PersistentOptions configures a PersistentFilter.
+type PersistentOptions struct {
+	Sync         SyncPolicy
+	SyncInterval time.Duration
+
+	// SnapshotEvery writes a snapshot and empties the log after this many
+	// logged adds.  Zero only snapshots on explicit calls and on Close.
+	SnapshotEvery int
+}
+
+const (
+	snapshotName = "snapshot"
+	walName      = "wal"
+	recordSize   = 12 // 8 byte hash, 4 byte CRC-32C of the hash
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// walFile is the part of *os.File the log uses.
+type walFile interface {
+	io.ReadWriteSeeker
+	Truncate(size int64) error
+	Sync() error
+	Close() error
+}
+
+// A PersistentFilter is a Filter kept in a directory as a snapshot of Data
+// plus a write-ahead log of the hashes added since.  Adding a hash is
+// idempotent, so replaying a log over a snapshot that already holds some of
+// its records is harmless; this keeps recovery simple at every crash point.
+type PersistentFilter struct {
+	mu       sync.Mutex
+	f        Filter
+	dir      string
+	wal      walFile
+	walSize  int64 // end of the last whole record
+	err      error // set when a torn record could not be removed
+	opts     PersistentOptions
+	records  int
+	lastSync time.Time
+}
+
+// OpenPersistent opens the filter stored in dir, creating a filter of size
+// bytes if the directory holds none.  The log is replayed over the latest
+// snapshot, and a torn or corrupt record at the tail is discarded.
+func OpenPersistent(dir string, size int, opts *PersistentOptions) (*PersistentFilter, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	p := &PersistentFilter{dir: dir, lastSync: time.Now()}
+	if opts != nil {
+		p.opts = *opts
+	}
+
+	snap, err := os.ReadFile(filepath.Join(dir, snapshotName))
+	switch {
+	case err == nil:
+		if err := p.f.UnmarshalCompressed(snap); err != nil {
+			return nil, fmt.Errorf("Loading snapshot: %w", err)
+		}
+	case os.IsNotExist(err):
+		if size < 1 {
+			return nil, fmt.Errorf("Filter size (%d) has to be a positive value", size)
+		}
+		p.f.Data = make([]byte, size)
+	default:
+		return nil, err
+	}
+
+	wal, err := os.OpenFile(filepath.Join(dir, walName), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	p.wal = wal
+	if err := p.replay(); err != nil {
+		p.wal.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// replay applies the log and truncates it after the last good record.
+func (p *PersistentFilter) replay() error {
+	log, err := io.ReadAll(p.wal)
+	if err != nil {
+		return err
+	}
+	good := 0
+	for ; good+recordSize <= len(log); good += recordSize {
+		rec := log[good : good+recordSize]
+		if crc32.Checksum(rec[:8], castagnoli) != binary.LittleEndian.Uint32(rec[8:]) {
+			break
+		}
+		p.f.add(binary.LittleEndian.Uint64(rec))
+		p.records++
+	}
+	if good < len(log) {
+		if err := p.wal.Truncate(int64(good)); err != nil {
+			return err
+		}
+	}
+	p.walSize = int64(good)
+	_, err = p.wal.Seek(p.walSize, io.SeekStart)
+	return err
+}
+
+// Test if the string may be in the filter
+func (p *PersistentFilter) TestString(s string) bool {
+	return p.test(zxxh3.Hash(s2b(s)))
+}
+
+// Test if a byte slice may be in the filter
+func (p *PersistentFilter) Test(d []byte) bool {
+	return p.test(zxxh3.Hash(d))
+}
+
+// Add a string to the filter
+func (p *PersistentFilter) AddString(s string) (hash uint64, err error) {
+	hash = zxxh3.Hash(s2b(s))
+	return hash, p.add(hash)
+}
+
+// Add a byte slice to the filter
+func (p *PersistentFilter) Add(d []byte) (hash uint64, err error) {
+	hash = zxxh3.Hash(d)
+	return hash, p.add(hash)
+}
+
+func (p *PersistentFilter) test(hash uint64) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.f.test(hash)
+}
+
+func (p *PersistentFilter) add(hash uint64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	if p.f.test(hash) {
+		return nil // already present, nothing to log
+	}
+
+	var rec [recordSize]byte
+	binary.LittleEndian.PutUint64(rec[:], hash)
+	binary.LittleEndian.PutUint32(rec[8:], crc32.Checksum(rec[:8], castagnoli))
+	if _, err := p.wal.Write(rec[:]); err != nil {
+		return p.rewind(err)
+	}
+	p.walSize += recordSize
+	p.f.add(hash)
+	p.records++
+
+	switch {
+	case p.opts.SnapshotEvery > 0 && p.records >= p.opts.SnapshotEvery:
+		return p.snapshot()
+	case p.opts.Sync == SyncAlways,
+		p.opts.Sync == SyncInterval && time.Since(p.lastSync) >= p.opts.SyncInterval:
+		return p.sync()
+	}
+	return nil
+}
+
+// rewind cuts a partly written record off the log, as replay stops at the
+// first bad record and would drop every record logged after it.  If the log
+// cannot be cut, adds fail until a snapshot empties it.
+func (p *PersistentFilter) rewind(err error) error {
+	if terr := p.wal.Truncate(p.walSize); terr != nil {
+		p.err = fmt.Errorf("Log may hold a torn record: %w", terr)
+	} else if _, serr := p.wal.Seek(p.walSize, io.SeekStart); serr != nil {
+		p.err = fmt.Errorf("Log may hold a torn record: %w", serr)
+	}
+	return err
+}
+
+// Sync flushes the log to stable storage.
+func (p *PersistentFilter) Sync() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.sync()
+}
+
+func (p *PersistentFilter) sync() error {
+	p.lastSync = time.Now()
+	return p.wal.Sync()
+}
+
+// Snapshot writes Data to a new snapshot, atomically replacing the old one,
+// and then empties the log.
+func (p *PersistentFilter) Snapshot() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.snapshot()
+}
+
+func (p *PersistentFilter) snapshot() error {
+	name := filepath.Join(p.dir, snapshotName)
+	tmp, err := os.CreateTemp(p.dir, snapshotName+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(p.f.MarshalCompressed()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return err
+	}
+	if err := syncDir(p.dir); err != nil {
+		return err
+	}
+
+	// A crash before the truncate only means replaying records the
+	// snapshot already holds
+	if err := p.wal.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := p.wal.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	p.walSize, p.err = 0, nil
+	p.records = 0
+	return p.sync()
+}
+
+// Close snapshots the filter and closes the log.
+func (p *PersistentFilter) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	err := p.snapshot()
+	if cerr := p.wal.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Filter returns a copy of the current filter.
+func (p *PersistentFilter) Filter() *Filter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return &Filter{Data: append([]byte(nil), p.f.Data...)}
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,193 @@
+package bwdb_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	bloom "github.com/pschou/go-bloom"
+)
+
+func ExampleOpenPersistent() {
+	dir, _ := os.MkdirTemp("", "bloom")
+	defer os.RemoveAll(dir)
+
+	filter, _ := bloom.OpenPersistent(dir, 100, &bloom.PersistentOptions{Sync: bloom.SyncAlways})
+	filter.AddString("hello")
+	filter.Close()
+
+	filter, _ = bloom.OpenPersistent(dir, 100, nil)
+	fmt.Println("test", filter.TestString("hello"))
+	filter.Close()
+	// Output:
+	// test true
+}
+
+// crash abandons the filter without a final snapshot, as a process exit
+// would.
+func crash(t *testing.T, dir string, keys int) {
+	t.Helper()
+	p, err := bloom.OpenPersistent(dir, 1<<12, &bloom.PersistentOptions{Sync: bloom.SyncNever})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < keys; i++ {
+		if _, err := p.AddString(strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Sync(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPersistentReplay(t *testing.T) {
+	dir := t.TempDir()
+	crash(t, dir, 100)
+	if _, err := os.Stat(filepath.Join(dir, "snapshot")); !os.IsNotExist(err) {
+		t.Fatal("expected no snapshot before the first one is taken")
+	}
+
+	p, err := bloom.OpenPersistent(dir, 1<<12, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	for i := 0; i < 100; i++ {
+		if !p.TestString(strconv.Itoa(i)) {
+			t.Fatalf("key %d lost in replay", i)
+		}
+	}
+}
+
+func TestPersistentTruncatedTail(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		damage func(wal []byte) []byte
+		keep   int
+	}{
+		{"partial record", func(wal []byte) []byte { return wal[:len(wal)-5] }, 49},
+		{"bad checksum", func(wal []byte) []byte { wal[len(wal)-1] ^= 0xff; return wal }, 49},
+		{"garbage tail", func(wal []byte) []byte { return append(wal, 1, 2, 3) }, 50},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			crash(t, dir, 50)
+			name := filepath.Join(dir, "wal")
+			wal, err := os.ReadFile(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(name, tc.damage(wal), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			p, err := bloom.OpenPersistent(dir, 1<<12, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < tc.keep; i++ {
+				if !p.TestString(strconv.Itoa(i)) {
+					t.Fatalf("key %d lost", i)
+				}
+			}
+
+			// The log is usable after the damaged tail was dropped
+			p.AddString("after")
+			p.Sync()
+			if st, _ := os.Stat(name); st.Size()%12 != 0 {
+				t.Errorf("log size %d is not a whole number of records", st.Size())
+			}
+			crash(t, dir, 0)
+			p, err = bloom.OpenPersistent(dir, 1<<12, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !p.TestString("after") {
+				t.Error("add after recovery was lost")
+			}
+			p.Close()
+		})
+	}
+}
+
+func TestPersistentSnapshotEvery(t *testing.T) {
+	dir := t.TempDir()
+	p, err := bloom.OpenPersistent(dir, 1<<12, &bloom.PersistentOptions{SnapshotEvery: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 25; i++ {
+		p.AddString(strconv.Itoa(i))
+	}
+	if st, err := os.Stat(filepath.Join(dir, "wal")); err != nil || st.Size() > 10*12 {
+		t.Errorf("log was not emptied by the snapshot: %v %v", st.Size(), err)
+	}
+
+	// A crash between the snapshot and the log truncation replays records
+	// the snapshot already holds
+	wal, _ := os.ReadFile(filepath.Join(dir, "wal"))
+	p.Snapshot()
+	os.WriteFile(filepath.Join(dir, "wal"), wal, 0o644)
+
+	p, err = bloom.OpenPersistent(dir, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	for i := 0; i < 25; i++ {
+		if !p.TestString(strconv.Itoa(i)) {
+			t.Fatalf("key %d lost", i)
+		}
+	}
+	if len(p.Filter().Data) != 1<<12 {
+		t.Error("snapshot size was not kept")
+	}
+}
+
+func TestPersistentShortWrite(t *testing.T) {
+	dir := t.TempDir()
+	p, err := bloom.OpenPersistent(dir, 1<<12, &bloom.PersistentOptions{Sync: bloom.SyncNever})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.AddString("before")
+	bloom.FailLog(p, 5, false)
+	if _, err := p.AddString("torn"); err == nil {
+		t.Fatal("expected an error from the short write")
+	}
+	if p.TestString("torn") {
+		t.Error("failed add is in the filter")
+	}
+	if _, err := p.AddString("after"); err != nil {
+		t.Fatal(err)
+	}
+	p.Sync()
+
+	// Records logged after the torn one survive a crash
+	p, err = bloom.OpenPersistent(dir, 1<<12, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.TestString("before") || !p.TestString("after") {
+		t.Error("acknowledged add lost in replay")
+	}
+
+	// A torn record that cannot be cut off stops adds until a snapshot
+	bloom.FailLog(p, 5, true)
+	if _, err := p.AddString("torn"); err == nil {
+		t.Fatal("expected an error from the short write")
+	}
+	if _, err := p.AddString("blocked"); err == nil {
+		t.Error("add succeeded after a torn record")
+	}
+	if err := p.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.AddString("resumed"); err != nil {
+		t.Error(err)
+	}
+	p.Close()
+}
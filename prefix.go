@@ -0,0 +1,134 @@
+// Copyright 2020 github.com/pschou/go-bloom-worm
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bwdb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	zxxh3 "github.com/zeebo/xxh3"
+)
+
+// prefixSeed keeps the hashes of prefixes apart from those of whole keys, so
+// a prefix of one key does not make Test positive for another.
+const prefixSeed = 0x7072656669780000
+
+// PrefixOptions selects which prefixes of every key are stored.
+type PrefixOptions struct {
+	// Lengths stores the first n bytes of a key for every n listed.
+	Lengths []int
+
+	// Delimiter stores the part of a key before every occurrence of it, so
+	// "tenant/bucket/object" stores "tenant" and "tenant/bucket" for "/".
+	Delimiter string
+
+	// MaxDepth bounds the number of delimiter prefixes stored per key to the
+	// first MaxDepth, zero meaning no bound.
+	MaxDepth int
+}
+
+// A PrefixFilter answers if any key under a prefix may be present, by storing
+// the configured prefixes of every key next to the key itself.
+type PrefixFilter struct {
+	Filter  Filter
+	Options PrefixOptions
+}
+
+// NewPrefixFilter creates a filter of size bytes storing the prefixes
+// selected by opts.  Every length has to be positive.
+func NewPrefixFilter(size int, opts PrefixOptions) (*PrefixFilter, error) {
+	if size < 1 {
+		return nil, fmt.Errorf("Filter size (%d) has to be a positive value", size)
+	} else if opts.MaxDepth < 0 {
+		return nil, fmt.Errorf("Prefix MaxDepth (%d) cannot be negative", opts.MaxDepth)
+	}
+	for _, n := range opts.Lengths {
+		if n < 1 {
+			return nil, fmt.Errorf("Prefix length (%d) has to be a positive value", n)
+		}
+	}
+	opts.Lengths = append([]int(nil), opts.Lengths...)
+	sort.Ints(opts.Lengths)
+	return &PrefixFilter{Filter: Filter{Data: make([]byte, size)}, Options: opts}, nil
+}
+
+// Add a string and its prefixes to the filter
+func (f *PrefixFilter) AddString(s string) {
+	f.Filter.AddString(s)
+	for _, n := range f.Options.Lengths {
+		if n > len(s) {
+			break
+		}
+		f.Filter.add(zxxh3.HashStringSeed(s[:n], prefixSeed))
+	}
+	if d := f.Options.Delimiter; d != "" {
+		for i, depth := 0, 0; f.Options.MaxDepth == 0 || depth < f.Options.MaxDepth; depth++ {
+			j := strings.Index(s[i:], d)
+			if j < 0 {
+				break
+			}
+			f.Filter.add(zxxh3.HashStringSeed(s[:i+j], prefixSeed))
+			i += j + len(d)
+		}
+	}
+}
+
+// Add a byte slice and its prefixes to the filter
+func (f *PrefixFilter) Add(d []byte) {
+	f.AddString(string(d))
+}
+
+// Test if the string may be in the filter
+func (f *PrefixFilter) TestString(s string) bool {
+	return f.Filter.TestString(s)
+}
+
+// Test if a byte slice may be in the filter
+func (f *PrefixFilter) Test(d []byte) bool {
+	return f.Filter.Test(d)
+}
+
+// TestPrefix tests if any key starting with p may be in the filter.  As only
+// the configured prefixes are stored, p is checked through the longest
+// stored prefix it contains: the longest configured length up to len(p),
+// and the part before its last delimiter within MaxDepth.  A p ending in the
+// delimiter is matched exactly.  When no stored prefix applies, as for a p
+// shorter than every length and without a delimiter, the answer is true.
+func (f *PrefixFilter) TestPrefix(p string) bool {
+	for i := len(f.Options.Lengths) - 1; i >= 0; i-- {
+		if n := f.Options.Lengths[i]; n <= len(p) {
+			if !f.Filter.test(zxxh3.HashStringSeed(p[:n], prefixSeed)) {
+				return false
+			}
+			break
+		}
+	}
+	if d := f.Options.Delimiter; d != "" {
+		end := -1
+		for i, depth := 0, 0; f.Options.MaxDepth == 0 || depth < f.Options.MaxDepth; depth++ {
+			j := strings.Index(p[i:], d)
+			if j < 0 {
+				break
+			}
+			end = i + j
+			i += j + len(d)
+		}
+		if end >= 0 && !f.Filter.test(zxxh3.HashStringSeed(p[:end], prefixSeed)) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,89 @@
+package bwdb_test
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	bloom "github.com/pschou/go-bloom"
+)
+
+func ExamplePrefixFilter() {
+	filter, _ := bloom.NewPrefixFilter(1<<12, bloom.PrefixOptions{Delimiter: "/"})
+	filter.AddString("tenant/bucket/object")
+
+	fmt.Println("tenant/", filter.TestPrefix("tenant/"))
+	fmt.Println("tenant/bucket/", filter.TestPrefix("tenant/bucket/"))
+	fmt.Println("tenant/other/", filter.TestPrefix("tenant/other/"))
+	fmt.Println("tenant/bucket", filter.TestString("tenant/bucket"))
+	// Output:
+	// tenant/ true
+	// tenant/bucket/ true
+	// tenant/other/ false
+	// tenant/bucket false
+}
+
+func TestPrefixFilter(t *testing.T) {
+	opts := []bloom.PrefixOptions{
+		{Lengths: []int{8, 2, 4}},
+		{Delimiter: "/"},
+		{Delimiter: "::", MaxDepth: 2},
+		{Lengths: []int{3}, Delimiter: "/", MaxDepth: 1},
+	}
+	for _, o := range opts {
+		filter, err := bloom.NewPrefixFilter(1<<14, o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := o.Delimiter
+		if d == "" {
+			d = "/"
+		}
+		var keys []string
+		for i := 0; i < 200; i++ {
+			k := "t" + strconv.Itoa(i%7) + d + "b" + strconv.Itoa(i%13) + d + "o" + d + strconv.Itoa(i)
+			keys = append(keys, k)
+			filter.AddString(k)
+		}
+		for _, k := range keys {
+			if !filter.TestString(k) {
+				t.Fatalf("%+v: missing key %q", o, k)
+			}
+			for n := 0; n <= len(k); n++ {
+				if !filter.TestPrefix(k[:n]) {
+					t.Fatalf("%+v: missing prefix %q", o, k[:n])
+				}
+			}
+		}
+
+		var positives int
+		for i := 0; i < 1000; i++ {
+			p := "x" + strconv.Itoa(i) + d
+			if filter.TestPrefix(p + "y" + d) {
+				positives++
+			}
+		}
+		if positives > 100 {
+			t.Errorf("%+v: %d of 1000 absent prefixes tested positive", o, positives)
+		}
+	}
+
+	// Only the first MaxDepth delimiter prefixes are stored
+	filter, _ := bloom.NewPrefixFilter(1<<10, bloom.PrefixOptions{Delimiter: "/", MaxDepth: 1})
+	filter.AddString("a/b/c")
+	if !filter.TestPrefix("a/zzz/") {
+		t.Error("expected a prefix past MaxDepth to fall back to the first level")
+	}
+	if filter.TestPrefix("b/") {
+		t.Error("unexpected positive for an absent first level")
+	}
+
+	for _, o := range []bloom.PrefixOptions{{Lengths: []int{4, 0}}, {Lengths: []int{-1}}, {Delimiter: "/", MaxDepth: -1}} {
+		if _, err := bloom.NewPrefixFilter(1<<10, o); err == nil {
+			t.Errorf("%+v: expected an error", o)
+		}
+	}
+	if _, err := bloom.NewPrefixFilter(0, bloom.PrefixOptions{}); err == nil {
+		t.Error("expected an error for a zero size")
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright 2020 github.com/pschou/go-bloom-worm
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Private set intersection with bloom filters, so two parties can find the
+// items they have in common without handing over their lists.
+//
+// Keyed is the simple scheme: both parties share an HMAC key and exchange
+// filters of keyed hashes.  Anyone holding the key can test guesses against
+// a filter, so the key has to stay with the two parties.
+//
+// Server and Client are the ECDH scheme, where no key is shared.  The server
+// publishes a filter of its items blinded with its secret scalar b, and the
+// client has its items, blinded with its own scalar a, blinded again by the
+// server.  Removing a leaves the client with its items blinded by b, which
+// it tests against the filter.  The server never sees the client's items,
+// and the client only learns which of its items the server has.
+
+package psi
+
+import (
+	"crypto/ecdh"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"math/big"
+
+	bloom "github.com/pschou/go-bloom"
+)
+
+// Keyed builds and tests filters of HMAC-SHA256 hashes of the items.
+type Keyed struct {
+	Key []byte
+}
+
+// Filter returns a filter of size bytes holding the items.
+func (k *Keyed) Filter(items [][]byte, size int) *bloom.Filter {
+	f := &bloom.Filter{Data: make([]byte, size)}
+	for _, item := range items {
+		f.Add(k.hash(item))
+	}
+	return f
+}
+
+// Intersect returns the items that test positive in the other party's
+// filter.
+func (k *Keyed) Intersect(f *bloom.Filter, items [][]byte) (out [][]byte) {
+	for _, item := range items {
+		if f.Test(k.hash(item)) {
+			out = append(out, item)
+		}
+	}
+	return
+}
+
+func (k *Keyed) hash(item []byte) []byte {
+	mac := hmac.New(sha256.New, k.Key)
+	mac.Write(item)
+	return mac.Sum(nil)
+}
+
+// Server holds the set that is published as an encrypted filter.
+type Server struct {
+	key *ecdh.PrivateKey
+}
+
+// NewServer creates a server with a random secret scalar.
+func NewServer(rand io.Reader) (*Server, error) {
+	key, err := ecdh.P256().GenerateKey(rand)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{key: key}, nil
+}
+
+// Filter returns a filter of size bytes holding the server's items, each
+// hashed to the curve and multiplied by the secret scalar.
+func (s *Server) Filter(items [][]byte, size int) (*bloom.Filter, error) {
+	f := &bloom.Filter{Data: make([]byte, size)}
+	for _, item := range items {
+		x, err := s.key.ECDH(hashToCurve(item))
+		if err != nil {
+			return nil, err
+		}
+		f.Add(x)
+	}
+	return f, nil
+}
+
+// Process multiplies the blinded items from a client by the secret scalar.
+func (s *Server) Process(blinded [][]byte) ([][]byte, error) {
+	out := make([][]byte, len(blinded))
+	for i, b := range blinded {
+		p, err := pointFromX(b)
+		if err != nil {
+			return nil, fmt.Errorf("blinded item %d: %w", i, err)
+		}
+		if out[i], err = s.key.ECDH(p); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// Client holds the set that is checked against a server's filter.
+type Client struct {
+	key, inverse *ecdh.PrivateKey
+}
+
+// NewClient creates a client with a random secret scalar.
+func NewClient(rand io.Reader) (*Client, error) {
+	key, err := ecdh.P256().GenerateKey(rand)
+	if err != nil {
+		return nil, err
+	}
+	a := new(big.Int).SetBytes(key.Bytes())
+	a.ModInverse(a, curve.N)
+	inverse, err := ecdh.P256().NewPrivateKey(a.FillBytes(make([]byte, 32)))
+	if err != nil {
+		return nil, err
+	}
+	return &Client{key: key, inverse: inverse}, nil
+}
+
+// Blind returns the items hashed to the curve and multiplied by the secret
+// scalar, to send to the server.
+func (c *Client) Blind(items [][]byte) ([][]byte, error) {
+	out := make([][]byte, len(items))
+	for i, item := range items {
+		var err error
+		if out[i], err = c.key.ECDH(hashToCurve(item)); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// Intersect removes the client's scalar from the items processed by the
+// server, in the same order as given to Blind, and returns the items that
+// test positive in the server's filter.
+func (c *Client) Intersect(f *bloom.Filter, items, processed [][]byte) ([][]byte, error) {
+	if len(items) != len(processed) {
+		return nil, fmt.Errorf("Got %d processed items for %d items", len(processed), len(items))
+	}
+	var out [][]byte
+	for i, b := range processed {
+		p, err := pointFromX(b)
+		if err != nil {
+			return nil, fmt.Errorf("processed item %d: %w", i, err)
+		}
+		x, err := c.inverse.ECDH(p)
+		if err != nil {
+			return nil, err
+		}
+		if f.Test(x) {
+			out = append(out, items[i])
+		}
+	}
+	return out, nil
+}
+
+var curve = elliptic.P256().Params()
+
+// hashToCurve maps an item to a P-256 point by try-and-increment: the
+// SHA-256 of a counter and the item is used as x until x³ - 3x + b is a
+// square.
+func hashToCurve(item []byte) *ecdh.PublicKey {
+	for ctr := byte(0); ; ctr++ {
+		h := sha256.New()
+		h.Write([]byte{ctr})
+		h.Write(item)
+		if p, err := pointFromX(h.Sum(nil)); err == nil {
+			return p
+		}
+	}
+}
+
+// pointFromX returns one of the two points with the given x coordinate.
+// ECDH only shares the x coordinate, and as the points are P and -P, every
+// later multiplication gives the same x either way.
+func pointFromX(b []byte) (*ecdh.PublicKey, error) {
+	if len(b) != 32 {
+		return nil, fmt.Errorf("Coordinate of %d bytes, want 32", len(b))
+	}
+	x := new(big.Int).SetBytes(b)
+	if x.Cmp(curve.P) >= 0 {
+		return nil, fmt.Errorf("Coordinate out of range")
+	}
+	// y² = x³ - 3x + b, with the square root as y2^((p+1)/4) as p = 3 mod 4
+	y2 := new(big.Int).Exp(x, big.NewInt(3), curve.P)
+	y2.Sub(y2, new(big.Int).Lsh(x, 1))
+	y2.Sub(y2, x)
+	y2.Add(y2, curve.B)
+	y2.Mod(y2, curve.P)
+	exp := new(big.Int).Add(curve.P, big.NewInt(1))
+	y := new(big.Int).Exp(y2, exp.Rsh(exp, 2), curve.P)
+	if new(big.Int).Exp(y, big.NewInt(2), curve.P).Cmp(y2) != 0 {
+		return nil, fmt.Errorf("Coordinate is not on the curve")
+	}
+	buf := make([]byte, 65)
+	buf[0] = 4
+	x.FillBytes(buf[1:33])
+	y.FillBytes(buf[33:])
+	return ecdh.P256().NewPublicKey(buf)
+}
@@ -0,0 +1,107 @@
+package psi_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"testing"
+
+	bloom "github.com/pschou/go-bloom"
+	"github.com/pschou/go-bloom/psi"
+)
+
+func items(prefix string, lo, hi int) (out [][]byte) {
+	for i := lo; i < hi; i++ {
+		out = append(out, []byte(fmt.Sprintf("%s%d@example.com", prefix, i)))
+	}
+	return
+}
+
+func sameItems(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestKeyed(t *testing.T) {
+	alice, bob := items("user", 0, 300), items("user", 200, 500)
+	k := &psi.Keyed{Key: []byte("shared key")}
+
+	// Alice sends her filter, Bob finds the overlap
+	f := k.Filter(alice, bloom.SizeFor(len(alice), 1e-6))
+	if got := k.Intersect(f, bob); !sameItems(got, bob[:100]) {
+		t.Errorf("got %d common items, want 100", len(got))
+	}
+
+	other := &psi.Keyed{Key: []byte("other key")}
+	if got := other.Intersect(f, bob); len(got) > 1 {
+		t.Errorf("a different key found %d common items", len(got))
+	}
+}
+
+func TestECDH(t *testing.T) {
+	serverItems, clientItems := items("user", 0, 300), items("user", 250, 350)
+	server, err := psi.NewServer(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := psi.NewClient(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Server publishes its encrypted filter
+	f, err := server.Filter(serverItems, bloom.SizeFor(len(serverItems), 1e-6))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Client blinds its items, the server blinds them again
+	blinded, err := client.Blind(clientItems)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, b := range blinded {
+		if bytes.Contains(b, clientItems[i]) {
+			t.Fatal("blinded item leaks the item")
+		}
+	}
+	processed, err := server.Process(blinded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := client.Intersect(f, clientItems, processed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameItems(got, clientItems[:50]) {
+		t.Errorf("got %d common items, want 50", len(got))
+	}
+
+	// Another server's filter holds nothing the client can match
+	other, _ := psi.NewServer(rand.Reader)
+	if got, _ := client.Intersect(f, clientItems, must(other.Process(blinded))); len(got) > 1 {
+		t.Errorf("mismatched keys found %d common items", len(got))
+	}
+
+	if _, err := server.Process([][]byte{make([]byte, 31)}); err == nil {
+		t.Error("expected an error for a short coordinate")
+	}
+	if _, err := client.Intersect(f, clientItems, processed[1:]); err == nil {
+		t.Error("expected an error for mismatched lengths")
+	}
+}
+
+func must(b [][]byte, err error) [][]byte {
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
@@ -0,0 +1,337 @@
+// Copyright 2020 github.com/pschou/go-bloom-worm
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bwdb
+
+import (
+	"fmt"
+	"sort"
+
+	zxxh3 "github.com/zeebo/xxh3"
+)
+
+// A QuotientFilter stores a q+r bit fingerprint of every key, taken from the
+// top of the xxh3 hash.  The top q bits pick a home slot and the remaining r
+// bits are stored in it, with runs of the same quotient shifted right as
+// slots fill up.  As the fingerprints are kept, the filter can delete keys,
+// grow and merge without the original keys.
+//
+// Keys are counted as a multiset: inserting a key twice stores it twice, so
+// every Delete undoes exactly one Insert.
+type QuotientFilter struct {
+	q, r  uint
+	n     int
+	slots []uint64 // remainder<<3 | metadata bits
+}
+
+const (
+	qfOccupied     = 1 << iota // some key has this slot as its home
+	qfContinuation             // same quotient as the slot before
+	qfShifted                  // not stored in its home slot
+	qfMeta         = qfOccupied | qfContinuation | qfShifted
+)
+
+type qfEntry struct {
+	quot, rem uint64
+}
+
+// NewQuotientFilter creates a filter of 2^q slots holding r bit remainders,
+// with q+r at most 64 and r at most 61.
+// It can hold up to 2^q - 1 fingerprints with a false positive rate of about
+// n / 2^(q+r).
+func NewQuotientFilter(q, r uint) (*QuotientFilter, error) {
+	if q < 1 || q > 32 {
+		return nil, fmt.Errorf("Quotient bits (%d) has to be between 1 and 32", q)
+	}
+	// Each slot keeps three metadata bits below the remainder
+	maxR := 64 - q
+	if maxR > 64-3 {
+		maxR = 64 - 3
+	}
+	if r < 1 || r > maxR {
+		return nil, fmt.Errorf("Remainder bits (%d) has to be between 1 and %d", r, maxR)
+	}
+	return &QuotientFilter{q: q, r: r, slots: make([]uint64, 1<<q)}, nil
+}
+
+// Len returns the number of fingerprints stored.
+func (f *QuotientFilter) Len() int {
+	return f.n
+}
+
+// Insert a byte slice into the filter
+func (f *QuotientFilter) Insert(d []byte) error {
+	return f.insert(f.fingerprint(zxxh3.Hash(d)))
+}
+
+// Insert a string into the filter
+func (f *QuotientFilter) InsertString(s string) error {
+	return f.insert(f.fingerprint(zxxh3.Hash(s2b(s))))
+}
+
+// Lookup if a byte slice may be in the filter
+func (f *QuotientFilter) Lookup(d []byte) bool {
+	return f.lookup(f.fingerprint(zxxh3.Hash(d)))
+}
+
+// Lookup if a string may be in the filter
+func (f *QuotientFilter) LookupString(s string) bool {
+	return f.lookup(f.fingerprint(zxxh3.Hash(s2b(s))))
+}
+
+// Delete one copy of a byte slice from the filter, returning false when its
+// fingerprint is not stored.  Deleting a key that was never inserted may
+// remove the fingerprint of another key.
+func (f *QuotientFilter) Delete(d []byte) bool {
+	return f.delete(f.fingerprint(zxxh3.Hash(d)))
+}
+
+// Delete one copy of a string from the filter
+func (f *QuotientFilter) DeleteString(s string) bool {
+	return f.delete(f.fingerprint(zxxh3.Hash(s2b(s))))
+}
+
+// Resize doubles the number of slots by moving one bit from the remainder to
+// the quotient of every stored fingerprint.  The false positive rate stays
+// that of the q+r bit fingerprints.
+func (f *QuotientFilter) Resize() error {
+	if f.r < 2 || f.q >= 32 {
+		return fmt.Errorf("Quotient filter cannot grow past %d quotient and %d remainder bits", f.q, f.r)
+	}
+	g, _ := NewQuotientFilter(f.q+1, f.r-1)
+	g.load(f.fingerprints())
+	*f = *g
+	return nil
+}
+
+// Merge adds every fingerprint of o into f, growing f until both fit.  The
+// filters need the same fingerprint size q+r.
+func (f *QuotientFilter) Merge(o *QuotientFilter) error {
+	if f.q+f.r != o.q+o.r {
+		return fmt.Errorf("Quotient filters differ in fingerprint size (%d and %d bits)", f.q+f.r, o.q+o.r)
+	}
+	q := f.q
+	if o.q > q {
+		q = o.q
+	}
+	for f.n+o.n >= 1<<q {
+		if q >= f.q+f.r-1 || q >= 32 {
+			return fmt.Errorf("Quotient filter cannot hold %d fingerprints", f.n+o.n)
+		}
+		q++
+	}
+
+	// Stream both sorted fingerprint lists into one
+	a, b := f.fingerprints(), o.fingerprints()
+	fps := make([]uint64, 0, len(a)+len(b))
+	for len(a) > 0 && len(b) > 0 {
+		if a[0] <= b[0] {
+			fps, a = append(fps, a[0]), a[1:]
+		} else {
+			fps, b = append(fps, b[0]), b[1:]
+		}
+	}
+	fps = append(append(fps, a...), b...)
+
+	g, _ := NewQuotientFilter(q, f.q+f.r-q)
+	g.load(fps)
+	*f = *g
+	return nil
+}
+
+func (f *QuotientFilter) fingerprint(hash uint64) uint64 {
+	return hash >> (64 - f.q - f.r)
+}
+
+func (f *QuotientFilter) next(i uint64) uint64 {
+	return (i + 1) & uint64(len(f.slots)-1)
+}
+
+func (f *QuotientFilter) prev(i uint64) uint64 {
+	return (i - 1) & uint64(len(f.slots)-1)
+}
+
+func (f *QuotientFilter) lookup(fp uint64) bool {
+	fq, fr := fp>>f.r, fp&(1<<f.r-1)
+	if f.slots[fq]&qfOccupied == 0 {
+		return false
+	}
+
+	// Walk back to the start of the cluster, then forward one run per
+	// occupied slot until reaching the run of fq.
+	b := fq
+	for f.slots[b]&qfShifted != 0 {
+		b = f.prev(b)
+	}
+	s := b
+	for b != fq {
+		for s = f.next(s); f.slots[s]&qfContinuation != 0; s = f.next(s) {
+		}
+		for b = f.next(b); f.slots[b]&qfOccupied == 0; b = f.next(b) {
+		}
+	}
+	for {
+		if f.slots[s]>>3 == fr {
+			return true
+		}
+		if s = f.next(s); f.slots[s]&qfContinuation == 0 {
+			return false
+		}
+	}
+}
+
+func (f *QuotientFilter) insert(fp uint64) error {
+	if f.n+1 >= len(f.slots) {
+		return fmt.Errorf("Quotient filter is full (%d fingerprints)", f.n)
+	}
+	fq, fr := fp>>f.r, fp&(1<<f.r-1)
+	s := f.clusterStart(fq)
+	entries := f.decode(s)
+	old := len(entries)
+	off := func(q uint64) uint64 { return (q - s) & uint64(len(f.slots)-1) }
+	i := sort.Search(len(entries), func(i int) bool {
+		e := entries[i]
+		return off(e.quot) > off(fq) || (e.quot == fq && e.rem >= fr)
+	})
+	entries = append(entries, qfEntry{})
+	copy(entries[i+1:], entries[i:])
+	entries[i] = qfEntry{fq, fr}
+	f.encode(s, entries, old)
+	f.n++
+	return nil
+}
+
+func (f *QuotientFilter) delete(fp uint64) bool {
+	fq, fr := fp>>f.r, fp&(1<<f.r-1)
+	if f.slots[fq]&qfOccupied == 0 {
+		return false
+	}
+	s := f.clusterStart(fq)
+	entries := f.decode(s)
+	for i, e := range entries {
+		if e.quot == fq && e.rem == fr {
+			f.encode(s, append(entries[:i:i], entries[i+1:]...), len(entries))
+			f.n--
+			return true
+		}
+	}
+	return false
+}
+
+// clusterStart returns the first slot of the cluster holding slot i, or i
+// itself when it is empty.
+func (f *QuotientFilter) clusterStart(i uint64) uint64 {
+	for f.slots[i]&qfShifted != 0 {
+		i = f.prev(i)
+	}
+	return i
+}
+
+// decode reads the entries from the cluster starting at s up to the next
+// empty slot.  Runs appear in the same order as their occupied bits, so a
+// queue of quotients gives the quotient of every run.
+func (f *QuotientFilter) decode(s uint64) (entries []qfEntry) {
+	var quots []uint64
+	var cur uint64
+	for i := s; f.slots[i]&qfMeta != 0; i = f.next(i) {
+		if f.slots[i]&qfOccupied != 0 {
+			quots = append(quots, i)
+		}
+		if f.slots[i]&qfContinuation == 0 {
+			cur, quots = quots[0], quots[1:]
+		}
+		entries = append(entries, qfEntry{cur, f.slots[i] >> 3})
+	}
+	return
+}
+
+// encode clears the old slots starting at s and writes the sorted entries
+// back, each run as close to its home slot as the runs before it allow.
+func (f *QuotientFilter) encode(s uint64, entries []qfEntry, old int) {
+	mask := uint64(len(f.slots) - 1)
+	for i := 0; i < old; i++ {
+		f.slots[(s+uint64(i))&mask] = 0
+	}
+	var pos uint64
+	for i, e := range entries {
+		off := (e.quot - s) & mask
+		v := e.rem << 3
+		if i > 0 && e.quot == entries[i-1].quot {
+			v |= qfContinuation
+		} else if off > pos {
+			pos = off
+		}
+		if pos != off {
+			v |= qfShifted
+		}
+		f.slots[(s+pos)&mask] = v
+		f.slots[(s+off)&mask] |= qfOccupied
+		pos++
+	}
+}
+
+// fingerprints returns every stored fingerprint in ascending order.
+func (f *QuotientFilter) fingerprints() []uint64 {
+	fps := make([]uint64, 0, f.n)
+	if f.n == 0 {
+		return fps
+	}
+	// Start after an empty slot so no cluster is cut in two
+	var e uint64
+	for f.slots[e]&qfMeta != 0 {
+		e++
+	}
+	for i, seen := f.next(e), 1; seen < len(f.slots); {
+		if f.slots[i]&qfMeta == 0 {
+			i, seen = f.next(i), seen+1
+			continue
+		}
+		entries := f.decode(i)
+		for _, e := range entries {
+			fps = append(fps, e.quot<<f.r|e.rem)
+		}
+		i, seen = (i+uint64(len(entries)))&uint64(len(f.slots)-1), seen+len(entries)
+	}
+	sort.Slice(fps, func(i, j int) bool { return fps[i] < fps[j] })
+	return fps
+}
+
+// load fills an empty filter from ascending fingerprints.  Runs are laid out
+// in a single pass; any that would wrap past the last slot are inserted one
+// at a time.
+func (f *QuotientFilter) load(fps []uint64) {
+	var pos uint64
+	for i, fp := range fps {
+		fq, fr := fp>>f.r, fp&(1<<f.r-1)
+		v := fr << 3
+		if i > 0 && fq == fps[i-1]>>f.r {
+			v |= qfContinuation
+		} else if fq > pos {
+			pos = fq
+		}
+		if pos >= uint64(len(f.slots)) {
+			for _, fp := range fps[i:] {
+				f.insert(fp)
+			}
+			return
+		}
+		if pos != fq {
+			v |= qfShifted
+		}
+		f.slots[pos] = v
+		f.slots[fq] |= qfOccupied
+		f.n++
+		pos++
+	}
+}
@@ -0,0 +1,170 @@
+package bwdb_test
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"testing"
+
+	bloom "github.com/pschou/go-bloom"
+)
+
+func ExampleQuotientFilter() {
+	filter, _ := bloom.NewQuotientFilter(4, 20)
+	filter.InsertString("hello")
+	filter.InsertString("world")
+	filter.DeleteString("world")
+
+	// Double the slots without the original keys
+	filter.Resize()
+	fmt.Println("len:", filter.Len())
+	fmt.Println("hello", filter.LookupString("hello"))
+	fmt.Println("world", filter.LookupString("world"))
+	// Output:
+	// len: 1
+	// hello true
+	// world false
+}
+
+// checkQuotient verifies the filter holds exactly the keys in want.  The
+// fingerprints are wide enough that a collision would point to a bug.
+func checkQuotient(t *testing.T, f *bloom.QuotientFilter, want map[string]int, gone []string) {
+	t.Helper()
+	n := 0
+	for k, c := range want {
+		if !f.LookupString(k) {
+			t.Fatalf("missing key %q", k)
+		}
+		n += c
+	}
+	if f.Len() != n {
+		t.Fatalf("len %d, want %d", f.Len(), n)
+	}
+	for _, k := range gone {
+		if want[k] == 0 && f.LookupString(k) {
+			t.Fatalf("deleted key %q still found", k)
+		}
+	}
+}
+
+func TestQuotientFilter(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	f, _ := bloom.NewQuotientFilter(8, 56)
+	want := map[string]int{}
+	var keys, gone []string
+
+	// Fill to almost every slot so clusters wrap around the end
+	for len(keys) < 255 {
+		k := strconv.Itoa(rng.Intn(200))
+		if err := f.InsertString(k); err != nil {
+			t.Fatal(err)
+		}
+		want[k]++
+		keys = append(keys, k)
+	}
+	checkQuotient(t, f, want, nil)
+	if err := f.InsertString("x"); err == nil {
+		t.Fatal("expected an error inserting into a full filter")
+	}
+
+	rng.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+	for _, k := range keys[:150] {
+		if !f.DeleteString(k) {
+			t.Fatalf("could not delete %q", k)
+		}
+		if want[k]--; want[k] == 0 {
+			delete(want, k)
+			gone = append(gone, k)
+		}
+		checkQuotient(t, f, want, gone)
+	}
+	if f.DeleteString("not there") {
+		t.Error("deleted a key that was never inserted")
+	}
+
+	if err := f.Resize(); err != nil {
+		t.Fatal(err)
+	}
+	checkQuotient(t, f, want, gone)
+
+	g, _ := bloom.NewQuotientFilter(6, 58)
+	for i := 0; i < 60; i++ {
+		k := "g" + strconv.Itoa(i)
+		g.InsertString(k)
+		want[k]++
+	}
+	if err := f.Merge(g); err != nil {
+		t.Fatal(err)
+	}
+	checkQuotient(t, f, want, gone)
+
+	// Merging past the capacity grows the filter
+	h, _ := bloom.NewQuotientFilter(6, 58)
+	if err := h.Merge(f); err != nil {
+		t.Fatal(err)
+	}
+	checkQuotient(t, h, want, gone)
+
+	small, _ := bloom.NewQuotientFilter(6, 20)
+	if err := f.Merge(small); err == nil {
+		t.Error("expected an error merging different fingerprint sizes")
+	}
+	if _, err := bloom.NewQuotientFilter(0, 8); err == nil {
+		t.Error("expected an error for zero quotient bits")
+	}
+	for _, qr := range [][2]uint{{1, 62}, {2, 62}, {1, 63}, {8, 57}} {
+		if _, err := bloom.NewQuotientFilter(qr[0], qr[1]); err == nil {
+			t.Errorf("expected an error for q=%d r=%d", qr[0], qr[1])
+		}
+	}
+}
+
+func TestQuotientFilterWidestRemainder(t *testing.T) {
+	// The widest remainder still fits above the metadata bits of a slot
+	for _, q := range []uint{1, 3} {
+		for i := 0; i < 200; i++ {
+			f, err := bloom.NewQuotientFilter(q, 61)
+			if err != nil {
+				t.Fatal(err)
+			}
+			k := "w" + strconv.Itoa(i)
+			f.InsertString(k)
+			if !f.LookupString(k) {
+				t.Fatalf("q=%d r=61: key %q lost", q, k)
+			}
+		}
+	}
+}
+
+func TestQuotientFilterDuplicates(t *testing.T) {
+	f, _ := bloom.NewQuotientFilter(4, 2)
+	for i := 0; i < 3; i++ {
+		f.Insert([]byte("a"))
+	}
+	for i := 0; i < 3; i++ {
+		if !f.Delete([]byte("a")) {
+			t.Fatalf("delete %d failed", i)
+		}
+	}
+	if f.Delete([]byte("a")) || f.Lookup([]byte("a")) || f.Len() != 0 {
+		t.Error("key outlived its inserts")
+	}
+	if err := f.Resize(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Resize(); err == nil {
+		t.Error("expected an error growing past one remainder bit")
+	}
+}
+
+func BenchmarkQuotientLookup(b *testing.B) {
+	dat := []byte("helloworld")
+	filter, _ := bloom.NewQuotientFilter(16, 16)
+	for i := 0; i < 1<<15; i++ {
+		filter.InsertString(strconv.Itoa(i))
+	}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		filter.Lookup(dat)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2020 github.com/pschou/go-bloom-worm
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bwdb
+
+import (
+	"fmt"
+)
+
+// A RangeFilter answers if any uint64 key in a range may be present.  Like
+// Rosetta it keeps one Filter per dyadic level, where Levels[l] holds every
+// key shifted right by l, so a block of 2^l values can be tested with one
+// probe.  A range query tests the blocks covering it top-down and only
+// descends into blocks that test positive, so a false positive has to
+// survive one probe on every level down to the keys.
+//
+// Blocks above the top stored level cannot be tested; a range that fully
+// covers one of those tests positive.  Store all 64 levels to answer any
+// range.
+type RangeFilter struct {
+	Levels []Filter
+}
+
+// NewRangeFilter creates a filter with the given number of levels, 1 to 64,
+// of size bytes each.
+func NewRangeFilter(levels, size int) (*RangeFilter, error) {
+	if levels < 1 || levels > 64 {
+		return nil, fmt.Errorf("Range levels (%d) has to be between 1 and 64", levels)
+	} else if size < 1 {
+		return nil, fmt.Errorf("Range level size (%d) has to be a positive value", size)
+	}
+	f := &RangeFilter{Levels: make([]Filter, levels)}
+	for l := range f.Levels {
+		f.Levels[l].Data = make([]byte, size)
+	}
+	return f, nil
+}
+
+// Add a key to the filter
+func (f *RangeFilter) Add(v uint64) {
+	for l := range f.Levels {
+		f.Levels[l].AddUint64(v >> l)
+	}
+}
+
+// Test if a key may be in the filter
+func (f *RangeFilter) Test(v uint64) bool {
+	return f.Levels[0].TestUint64(v)
+}
+
+// TestRange tests if any key in [lo, hi] may be in the filter.
+func (f *RangeFilter) TestRange(lo, hi uint64) bool {
+	if lo > hi {
+		return false
+	}
+	return f.search(0, 63, lo, hi) || f.search(1, 63, lo, hi)
+}
+
+// search tests the part of [lo, hi] inside the block of prefix p at level l.
+func (f *RangeFilter) search(p uint64, l int, lo, hi uint64) bool {
+	first := p << l
+	last := first | (1<<l - 1)
+	switch {
+	case last < lo || first > hi:
+		return false
+	case lo <= first && last <= hi:
+		return f.covered(p, l)
+	case l < len(f.Levels) && !f.Levels[l].TestUint64(p):
+		return false
+	}
+	return f.search(p<<1, l-1, lo, hi) || f.search(p<<1|1, l-1, lo, hi)
+}
+
+// covered tests if any key in the block of prefix p at level l may be in the
+// filter, descending while the blocks test positive.
+func (f *RangeFilter) covered(p uint64, l int) bool {
+	if l >= len(f.Levels) {
+		return true
+	} else if !f.Levels[l].TestUint64(p) {
+		return false
+	} else if l == 0 {
+		return true
+	}
+	return f.covered(p<<1, l-1) || f.covered(p<<1|1, l-1)
+}
@@ -0,0 +1,84 @@
+package bwdb_test
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	bloom "github.com/pschou/go-bloom"
+)
+
+func ExampleRangeFilter() {
+	filter, _ := bloom.NewRangeFilter(64, 1<<12)
+	filter.Add(1000)
+	filter.Add(5000)
+
+	fmt.Println("[900, 1100]", filter.TestRange(900, 1100))
+	fmt.Println("[2000, 4000]", filter.TestRange(2000, 4000))
+	fmt.Println("5000", filter.Test(5000))
+	// Output:
+	// [900, 1100] true
+	// [2000, 4000] false
+	// 5000 true
+}
+
+func TestRangeFilter(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	const n = 2000
+	filter, _ := bloom.NewRangeFilter(64, bloom.SizeFor(n, 0.01))
+	keys := make([]uint64, n)
+	for i := range keys {
+		keys[i] = rng.Uint64() >> 24
+		filter.Add(keys[i])
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	for _, k := range keys {
+		if !filter.Test(k) || !filter.TestRange(k, k) || !filter.TestRange(k-rng.Uint64()%1000, k+rng.Uint64()%1000) {
+			t.Fatalf("missing key %d", k)
+		}
+	}
+	if !filter.TestRange(0, ^uint64(0)) {
+		t.Error("full range tested negative")
+	}
+	if filter.TestRange(10, 9) {
+		t.Error("empty range tested positive")
+	}
+
+	// Ranges of growing width in the gaps between keys
+	for _, width := range []uint64{1, 1 << 8, 1 << 20} {
+		var probes, positives int
+		for i := 1; i < n; i++ {
+			if keys[i]-keys[i-1] <= width+1 {
+				continue
+			}
+			lo := keys[i-1] + 1 + rng.Uint64()%(keys[i]-keys[i-1]-width-1)
+			probes++
+			if filter.TestRange(lo, lo+width-1) {
+				positives++
+			}
+		}
+		if fpr := float64(positives) / float64(probes); fpr > 0.1 {
+			t.Errorf("width %d: fpr %.3f over %d probes", width, fpr, probes)
+		}
+	}
+}
+
+func TestRangeFilterLevels(t *testing.T) {
+	filter, _ := bloom.NewRangeFilter(8, 1<<10)
+	filter.Add(1 << 20)
+	if !filter.TestRange(1<<20-5, 1<<20+5) {
+		t.Error("missing key")
+	}
+	// Fully covers a block of 2^8 values, which cannot be tested
+	if !filter.TestRange(0, 1<<9) {
+		t.Error("expected a conservative positive above the stored levels")
+	}
+	if filter.TestRange(1<<20+1, 1<<20+100) {
+		t.Error("unexpected positive below the stored levels")
+	}
+	if _, err := bloom.NewRangeFilter(65, 1); err == nil {
+		t.Error("expected an error for 65 levels")
+	}
+}
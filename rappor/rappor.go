@@ -0,0 +1,301 @@
+// Copyright 2020 github.com/pschou/go-bloom-worm
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// RAPPOR differentially private reports of a value as a bloom bit vector,
+// and the aggregation that estimates how often candidate values were sent.
+
+package rappor
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	bloom "github.com/pschou/go-bloom"
+	zxxh3 "github.com/zeebo/xxh3"
+)
+
+// Params are shared by the clients and the aggregator.
+type Params struct {
+	Bits    int // bits per report, a multiple of 8
+	Hashes  int // bits set per value
+	Cohorts int // clients are split into cohorts using different hashes
+
+	F float64 // permanent randomized response: a bit is replaced by a fair coin, rounded up to a multiple of 1/128
+	P float64 // instantaneous randomized response: chance a 0 bit is sent as 1
+	Q float64 // instantaneous randomized response: chance a 1 bit is sent as 1
+}
+
+func (p Params) check() error {
+	switch {
+	case p.Bits < 8 || p.Bits%8 != 0:
+		return fmt.Errorf("Bits (%d) has to be a positive multiple of 8", p.Bits)
+	case p.Hashes < 1 || p.Hashes > p.Bits:
+		return fmt.Errorf("Hashes (%d) has to be between 1 and %d", p.Hashes, p.Bits)
+	case p.Cohorts < 1:
+		return fmt.Errorf("Cohorts (%d) has to be a positive value", p.Cohorts)
+	case p.F < 0 || p.F > 127.0/128:
+		return fmt.Errorf("F (%v) has to be in [0, 127/128]", p.F)
+	case p.P < 0 || p.P > 1 || p.Q < 0 || p.Q > 1 || p.P == p.Q:
+		return fmt.Errorf("P (%v) and Q (%v) have to be different probabilities", p.P, p.Q)
+	}
+	return nil
+}
+
+// quantizedF is the F that Permanent applies: the chance that seven random
+// bits fall below F*128 is F rounded up to a multiple of 1/128.
+func (p Params) quantizedF() float64 {
+	return math.Ceil(p.F*128) / 128
+}
+
+// BloomBits returns the bits a value sets in a cohort.
+func (p Params) BloomBits(cohort int, value []byte) []int {
+	bits := make([]int, p.Hashes)
+	for i := range bits {
+		bits[i] = int(zxxh3.HashSeed(value, uint64(cohort)<<32|uint64(i)) % uint64(p.Bits))
+	}
+	return bits
+}
+
+// A Client reports values for one cohort.  The secret keys the permanent
+// randomized response, so it has to stay the same for the lifetime of the
+// client to keep repeated reports of a value from averaging the noise out.
+type Client struct {
+	Params Params
+	Cohort int
+	Secret []byte
+
+	// Rand is the source for the instantaneous randomized response,
+	// crypto/rand when nil.
+	Rand io.Reader
+}
+
+// MinSecretSize is the shortest secret NewClient accepts, in bytes.
+const MinSecretSize = 16
+
+// NewClient creates a client for a cohort.  A nil secret is replaced by 32
+// bytes from crypto/rand, which the caller has to save from Client.Secret
+// to keep the permanent responses across restarts; any other secret has to
+// be at least MinSecretSize bytes.
+func NewClient(params Params, cohort int, secret []byte) (*Client, error) {
+	if err := params.check(); err != nil {
+		return nil, err
+	} else if cohort < 0 || cohort >= params.Cohorts {
+		return nil, fmt.Errorf("Cohort (%d) has to be between 0 and %d", cohort, params.Cohorts-1)
+	}
+	if secret == nil {
+		secret = make([]byte, 32)
+		if _, err := io.ReadFull(rand.Reader, secret); err != nil {
+			return nil, err
+		}
+	} else if len(secret) < MinSecretSize {
+		return nil, fmt.Errorf("Secret size (%d) has to be at least %d bytes", len(secret), MinSecretSize)
+	}
+	return &Client{Params: params, Cohort: cohort, Secret: secret}, nil
+}
+
+// Encode returns the bloom encoding of a value before any noise.
+func (c *Client) Encode(value []byte) bloom.Filter {
+	f := bloom.Filter{Data: make([]byte, c.Params.Bits/8)}
+	for _, b := range c.Params.BloomBits(c.Cohort, value) {
+		f.Data[b>>3] |= 1 << (b & 7)
+	}
+	return f
+}
+
+// Permanent returns the permanent randomized response of a value, which is
+// the same every time the value is reported.  As in the reference client,
+// every bit draws one byte of HMAC-SHA256(secret, value): the low bit is the
+// fair coin and the other seven, compared with F*128, decide if the coin
+// replaces the bit.  Seven bits give F a resolution of 1/128, so F acts
+// rounded up to a multiple of that: an F of 0.3 acts as 39/128, about 0.305.
+// Estimate uses the same rounded F.
+func (c *Client) Permanent(value []byte) bloom.Filter {
+	f := c.Encode(value)
+	threshold := c.Params.F * 128
+	var stream []byte
+	for block := uint32(0); len(stream) < c.Params.Bits; block++ {
+		mac := hmac.New(sha256.New, c.Secret)
+		mac.Write(value)
+		if block > 0 {
+			binary.Write(mac, binary.BigEndian, block)
+		}
+		stream = mac.Sum(stream)
+	}
+	for i := 0; i < c.Params.Bits; i++ {
+		if float64(stream[i]>>1) < threshold {
+			f.Data[i>>3] = f.Data[i>>3]&^(1<<(i&7)) | (stream[i]&1)<<(i&7)
+		}
+	}
+	return f
+}
+
+// Report returns a report for a value: the permanent randomized response
+// with fresh instantaneous randomized response applied to every bit.
+func (c *Client) Report(value []byte) ([]byte, error) {
+	prr := c.Permanent(value)
+	r := c.Rand
+	if r == nil {
+		r = rand.Reader
+	}
+	noise := make([]byte, 2*c.Params.Bits)
+	if _, err := io.ReadFull(r, noise); err != nil {
+		return nil, err
+	}
+	report := make([]byte, c.Params.Bits/8)
+	for i := 0; i < c.Params.Bits; i++ {
+		prob := c.Params.P
+		if prr.Data[i>>3]&(1<<(i&7)) != 0 {
+			prob = c.Params.Q
+		}
+		if float64(binary.LittleEndian.Uint16(noise[2*i:]))/65536 < prob {
+			report[i>>3] |= 1 << (i & 7)
+		}
+	}
+	return report, nil
+}
+
+// An Aggregator counts the bits set in the reports of every cohort.
+type Aggregator struct {
+	Params  Params
+	Reports []int   // reports per cohort
+	Counts  [][]int // bits set per cohort
+}
+
+// NewAggregator creates an empty aggregator.
+func NewAggregator(params Params) (*Aggregator, error) {
+	if err := params.check(); err != nil {
+		return nil, err
+	}
+	a := &Aggregator{Params: params, Reports: make([]int, params.Cohorts), Counts: make([][]int, params.Cohorts)}
+	for i := range a.Counts {
+		a.Counts[i] = make([]int, params.Bits)
+	}
+	return a, nil
+}
+
+// Add a report from a cohort
+func (a *Aggregator) Add(cohort int, report []byte) error {
+	if cohort < 0 || cohort >= a.Params.Cohorts {
+		return fmt.Errorf("Cohort (%d) has to be between 0 and %d", cohort, a.Params.Cohorts-1)
+	} else if len(report)*8 != a.Params.Bits {
+		return fmt.Errorf("Report size (%d) does not match %d bits", len(report), a.Params.Bits)
+	}
+	a.Reports[cohort]++
+	for i := range a.Counts[cohort] {
+		if report[i>>3]&(1<<(i&7)) != 0 {
+			a.Counts[cohort][i]++
+		}
+	}
+	return nil
+}
+
+// Estimate returns the estimated number of reports of every candidate value.
+// The share of reports with each bloom bit set is first recovered from the
+// noisy counts of every cohort, then fit by least squares to the bits each
+// candidate sets.  Values outside the candidates add error to the estimates,
+// which can come out negative for rare values.
+func (a *Aggregator) Estimate(candidates [][]byte) ([]float64, error) {
+	p := a.Params
+	n := len(candidates)
+	total := 0
+	for _, r := range a.Reports {
+		total += r
+	}
+	if n == 0 || total == 0 {
+		return make([]float64, n), nil
+	}
+
+	// Normal equations X'X b = X'y over every (cohort, bit) row, where X
+	// holds the bits set by each candidate and y the estimated share.
+	xtx := make([][]float64, n)
+	for i := range xtx {
+		xtx[i] = make([]float64, n+1) // with X'y as the last column
+	}
+	f := p.quantizedF()
+	scale := (1 - f) * (p.Q - p.P)
+	base := f/2*p.Q + (1-f/2)*p.P
+	for cohort, reports := range a.Reports {
+		if reports == 0 {
+			continue
+		}
+		sets := make([][]int, n)
+		rows := make([][]int, p.Bits) // candidates setting every bit
+		for c, v := range candidates {
+			sets[c] = p.BloomBits(cohort, v)
+			seen := map[int]bool{}
+			for _, b := range sets[c] {
+				if !seen[b] {
+					seen[b] = true
+					rows[b] = append(rows[b], c)
+				}
+			}
+		}
+		for b, cs := range rows {
+			y := (float64(a.Counts[cohort][b])/float64(reports) - base) / scale
+			for _, i := range cs {
+				xtx[i][n] += y
+				for _, j := range cs {
+					xtx[i][j]++
+				}
+			}
+		}
+	}
+
+	shares, err := solve(xtx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range shares {
+		shares[i] *= float64(total)
+	}
+	return shares, nil
+}
+
+// solve runs Gaussian elimination with partial pivoting on an augmented
+// matrix.
+func solve(m [][]float64) ([]float64, error) {
+	n := len(m)
+	for col := 0; col < n; col++ {
+		pivot := col
+		for r := col + 1; r < n; r++ {
+			if math.Abs(m[r][col]) > math.Abs(m[pivot][col]) {
+				pivot = r
+			}
+		}
+		if math.Abs(m[pivot][col]) < 1e-9 {
+			return nil, fmt.Errorf("Candidates cannot be told apart, candidate %d shares its bits with others", col)
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+		for r := col + 1; r < n; r++ {
+			k := m[r][col] / m[col][col]
+			for c := col; c <= n; c++ {
+				m[r][c] -= k * m[col][c]
+			}
+		}
+	}
+	x := make([]float64, n)
+	for r := n - 1; r >= 0; r-- {
+		v := m[r][n]
+		for c := r + 1; c < n; c++ {
+			v -= m[r][c] * x[c]
+		}
+		x[r] = v / m[r][r]
+	}
+	return x, nil
+}
@@ -0,0 +1,142 @@
+package rappor_test
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/pschou/go-bloom/rappor"
+)
+
+var params = rappor.Params{Bits: 64, Hashes: 2, Cohorts: 32, F: 0.5, P: 0.5, Q: 0.75}
+
+func TestClient(t *testing.T) {
+	c, err := rappor.NewClient(params, 3, []byte("a secret of 32 bytes, not less.."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := c.Encode([]byte("v"))
+	for _, b := range params.BloomBits(3, []byte("v")) {
+		if enc.Data[b>>3]&(1<<(b&7)) == 0 {
+			t.Errorf("bit %d not set", b)
+		}
+	}
+
+	// The permanent response is fixed per value and secret
+	a, b := c.Permanent([]byte("v")), c.Permanent([]byte("v"))
+	if !bytes.Equal(a.Data, b.Data) {
+		t.Error("permanent response changed between calls")
+	}
+	other := &rappor.Client{Params: params, Cohort: 3, Secret: []byte("other")}
+	if bytes.Equal(a.Data, other.Permanent([]byte("v")).Data) {
+		t.Error("permanent response does not depend on the secret")
+	}
+
+	// Without noise a report is the bloom encoding
+	exact := params
+	exact.F, exact.P, exact.Q = 0, 0, 1
+	c, _ = rappor.NewClient(exact, 3, nil)
+	r, err := c.Report([]byte("v"))
+	if err != nil || !bytes.Equal(r, enc.Data) {
+		t.Errorf("report %x, want %x (%v)", r, enc.Data, err)
+	}
+
+	if len(c.Secret) != 32 {
+		t.Errorf("generated a secret of %d bytes", len(c.Secret))
+	}
+	if _, err := rappor.NewClient(params, 3, []byte("secret")); err == nil {
+		t.Error("expected an error for a short secret")
+	}
+	if _, err := rappor.NewClient(params, 3, []byte{}); err == nil {
+		t.Error("expected an error for an empty secret")
+	}
+	if _, err := rappor.NewClient(params, 32, nil); err == nil {
+		t.Error("expected an error for a cohort out of range")
+	}
+	bad := params
+	bad.Bits = 12
+	if _, err := rappor.NewClient(bad, 0, nil); err == nil {
+		t.Error("expected an error for bits not a multiple of 8")
+	}
+}
+
+func TestPermanentRate(t *testing.T) {
+	// Bits outside the encoding are set when the coin replaces them and
+	// lands on 1, so at a rate of half the quantized F: 39/256 for 0.3
+	p := rappor.Params{Bits: 1024, Hashes: 1, Cohorts: 1, F: 0.3, P: 0.5, Q: 0.75}
+	c, err := rappor.NewClient(p, 0, []byte("a secret of 32 bytes, not less.."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, total := 0, 0
+	for i := 0; i < 1000; i++ {
+		v := []byte(strconv.Itoa(i))
+		home := p.BloomBits(0, v)[0]
+		prr := c.Permanent(v)
+		for b := 0; b < p.Bits; b++ {
+			if b != home {
+				total++
+				if prr.Data[b>>3]&(1<<(b&7)) != 0 {
+					set++
+				}
+			}
+		}
+	}
+	if rate := float64(set) / float64(total); math.Abs(rate-39.0/256) > 0.0015 {
+		t.Errorf("replaced bits set at %.5f, want %.5f", rate, 39.0/256)
+	}
+
+	p.F = 0.995
+	if _, err := rappor.NewClient(p, 0, nil); err == nil {
+		t.Error("expected an error for an F that rounds up to 1")
+	}
+}
+
+func TestAggregator(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	values := []string{"home", "search", "news", "mail", "maps"}
+	shares := []float64{0.4, 0.25, 0.15, 0.12, 0.08}
+	const n = 100000
+
+	agg, _ := rappor.NewAggregator(params)
+	for i := 0; i < n; i++ {
+		secret := make([]byte, 16)
+		rng.Read(secret)
+		c := &rappor.Client{Params: params, Cohort: rng.Intn(params.Cohorts), Secret: secret, Rand: rng}
+		v, u := 0, rng.Float64()
+		for ; u > shares[v]; v++ {
+			u -= shares[v]
+		}
+		r, err := c.Report([]byte(values[v]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := agg.Add(c.Cohort, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	candidates := [][]byte{[]byte("absent"), []byte("unused")}
+	for _, v := range values {
+		candidates = append(candidates, []byte(v))
+	}
+	est, err := agg.Estimate(candidates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append([]float64{0, 0}, shares...)
+	for i, e := range est {
+		if math.Abs(e/n-want[i]) > 0.03 {
+			t.Errorf("%s: estimated %.0f, want about %.0f", candidates[i], e, want[i]*n)
+		}
+	}
+
+	if err := agg.Add(0, []byte{1}); err == nil {
+		t.Error("expected an error for a short report")
+	}
+	if _, err := agg.Estimate([][]byte{[]byte("a"), []byte("a")}); err == nil {
+		t.Error("expected an error for candidates that cannot be told apart")
+	}
+}
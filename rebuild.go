@@ -0,0 +1,117 @@
+// Copyright 2020 github.com/pschou/go-bloom-worm
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bwdb
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Rebuild creates a filter of size bytes from the keys yielded by src, for
+// growing a filter that has become too full.  src stops early when yield
+// returns false.
+func Rebuild(src func(yield func([]byte) bool), size int) (*Filter, error) {
+	if size < 1 {
+		return nil, fmt.Errorf("Filter size (%d) has to be a positive value", size)
+	}
+	f := &Filter{Data: make([]byte, size)}
+	src(func(d []byte) bool {
+		f.Add(d)
+		return true
+	})
+	return f, nil
+}
+
+// A Resizable is a Filter that can also record the hash of every key added.
+// As a Filter picks its bit from the hash alone, the recorded hashes can be
+// added again to a filter of any size, so it can grow without the original
+// keys.  Folding only changes Filter, so a folded Resizable can still grow
+// back from the hashes.
+type Resizable struct {
+	Filter Filter
+	Hashes []uint64 // nil when hashes are not kept
+}
+
+// NewResizable creates a filter of size bytes, recording hashes if keep is
+// set.
+func NewResizable(size int, keep bool) (*Resizable, error) {
+	if size < 1 {
+		return nil, fmt.Errorf("Filter size (%d) has to be a positive value", size)
+	}
+	r := &Resizable{Filter: Filter{Data: make([]byte, size)}}
+	if keep {
+		r.Hashes = []uint64{}
+	}
+	return r, nil
+}
+
+// Add a byte slice to the filter
+func (r *Resizable) Add(d []byte) (hash uint64) {
+	hash = r.Filter.Add(d)
+	if r.Hashes != nil {
+		r.Hashes = append(r.Hashes, hash)
+	}
+	return
+}
+
+// Add a string to the filter
+func (r *Resizable) AddString(s string) (hash uint64) {
+	hash = r.Filter.AddString(s)
+	if r.Hashes != nil {
+		r.Hashes = append(r.Hashes, hash)
+	}
+	return
+}
+
+// Test if a byte slice may be in the filter
+func (r *Resizable) Test(d []byte) bool {
+	return r.Filter.Test(d)
+}
+
+// Test if the string may be in the filter
+func (r *Resizable) TestString(s string) bool {
+	return r.Filter.TestString(s)
+}
+
+// Fold will reduce the memory resident size of the filter by a factor n
+func (r *Resizable) Fold(n int) error {
+	return r.Filter.Fold(n)
+}
+
+// Resize replaces the filter with one of size bytes holding every recorded
+// hash.  Duplicate hashes are dropped from the record on the way.
+func (r *Resizable) Resize(size int) error {
+	if r.Hashes == nil {
+		return fmt.Errorf("Cannot resize a filter without recorded hashes")
+	} else if size < 1 {
+		return fmt.Errorf("Filter size (%d) has to be a positive value", size)
+	}
+	sort.Slice(r.Hashes, func(i, j int) bool { return r.Hashes[i] < r.Hashes[j] })
+	n := 0
+	for i, h := range r.Hashes {
+		if i == 0 || h != r.Hashes[n-1] {
+			r.Hashes[n] = h
+			n++
+		}
+	}
+	r.Hashes = r.Hashes[:n]
+
+	f := Filter{Data: make([]byte, size)}
+	for _, h := range r.Hashes {
+		f.add(h)
+	}
+	r.Filter = f
+	return nil
+}
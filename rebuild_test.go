@@ -0,0 +1,103 @@
+package bwdb_test
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"testing"
+
+	bloom "github.com/pschou/go-bloom"
+)
+
+func ExampleResizable() {
+	filter, _ := bloom.NewResizable(10, true)
+	filter.AddString("hello")
+	filter.AddString("world")
+
+	// Grow the filter without the original keys
+	filter.Resize(1000)
+	fmt.Println("size:", len(filter.Filter.Data))
+	fmt.Println("hello", filter.TestString("hello"))
+	// Output:
+	// size: 1000
+	// hello true
+}
+
+func TestRebuild(t *testing.T) {
+	keys := make([][]byte, 1000)
+	for i := range keys {
+		keys[i] = []byte(strconv.Itoa(i))
+	}
+	src := func(yield func([]byte) bool) {
+		for _, k := range keys {
+			if !yield(k) {
+				return
+			}
+		}
+	}
+	f, err := bloom.Rebuild(src, 1<<12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := bloom.Filter{Data: make([]byte, 1<<12)}
+	for _, k := range keys {
+		want.Add(k)
+	}
+	if !bytes.Equal(f.Data, want.Data) {
+		t.Error("rebuilt filter differs from adding the keys")
+	}
+	if _, err := bloom.Rebuild(src, 0); err == nil {
+		t.Error("expected an error for a zero size")
+	}
+}
+
+func TestResizable(t *testing.T) {
+	r, err := bloom.NewResizable(64, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := bloom.Filter{Data: make([]byte, 1<<12)}
+	for i := 0; i < 1000; i++ {
+		r.AddString(strconv.Itoa(i))
+		r.Add([]byte(strconv.Itoa(i % 100))) // duplicates
+		want.AddString(strconv.Itoa(i))
+	}
+	if r.Filter.FillRatio() < 0.8 {
+		t.Fatalf("expected an overfull filter, fill %v", r.Filter.FillRatio())
+	}
+
+	if err := r.Resize(1 << 14); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Hashes) != 1000 {
+		t.Errorf("kept %d hashes, want 1000", len(r.Hashes))
+	}
+	if err := r.Fold(4); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(r.Filter.Data, want.Data) {
+		t.Error("grown and folded filter differs from adding the keys")
+	}
+	if err := r.Resize(1 << 16); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		if !r.TestString(strconv.Itoa(i)) {
+			t.Fatalf("missing key %d", i)
+		}
+	}
+
+	plain, _ := bloom.NewResizable(64, false)
+	plain.AddString("a")
+	if plain.Hashes != nil {
+		t.Error("recorded hashes without keep")
+	}
+	if err := plain.Resize(128); err == nil {
+		t.Error("expected an error resizing without recorded hashes")
+	}
+	for _, size := range []int{0, -1} {
+		if _, err := bloom.NewResizable(size, true); err == nil {
+			t.Errorf("expected an error for size %d", size)
+		}
+	}
+}
@@ -0,0 +1,4 @@
+package redisbloom
+
+// MurmurHash64A exposes the hash for the verification test.
+var MurmurHash64A = murmurHash64A
@@ -0,0 +1,276 @@
+// Copyright 2020 github.com/pschou/go-bloom-worm
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Load and dump RedisBloom filters using the BF.SCANDUMP / BF.LOADCHUNK
+// payloads, and answer BF.EXISTS the way RedisBloom does.
+
+package redisbloom
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Chain options, as stored in the dump header.
+const (
+	OptNoRound    = 1
+	OptEntsIsBits = 2
+	OptForce64    = 4
+	OptNoScaling  = 8
+)
+
+const (
+	headerSize = 8 + 4 + 4 + 4
+	linkSize   = 8 + 8 + 8 + 8 + 8 + 4 + 8 + 1
+)
+
+// A Link is one bloom filter in a scaling chain.  A non-scaling filter is a
+// chain with a single link.
+type Link struct {
+	Bytes   uint64  // length of Data
+	Bits    uint64  // number of addressable bits
+	Size    uint64  // items added to this link
+	Error   float64 // target false positive rate
+	BPE     float64 // bits per entry
+	Hashes  uint32
+	Entries uint64 // capacity
+	N2      uint8  // log2 of Bits when Bits is a power of two, else 0
+	Data    []byte
+}
+
+// A Chain is a RedisBloom scalable bloom filter.
+type Chain struct {
+	Size    uint64 // items added across all links
+	Options uint32
+	Growth  uint32
+	Links   []Link
+}
+
+// ScanDump returns the chunk BF.SCANDUMP would return for iter.  Iteration
+// starts at 0, which returns the header, and ends when the returned iterator
+// is 0.  Chunks are at most maxChunk bytes long.
+func (c *Chain) ScanDump(iter int64, maxChunk int) (next int64, data []byte) {
+	if iter == 0 {
+		return 1, c.header()
+	}
+	if maxChunk < 1 {
+		maxChunk = 1
+	}
+	link, offset := c.linkPos(iter)
+	if link == nil || offset >= uint64(len(link.Data)) {
+		return 0, nil // done, or the data was never loaded
+	}
+	n := uint64(maxChunk)
+	if remain := uint64(len(link.Data)) - offset; remain < n {
+		n = remain
+	}
+	return iter + int64(n), link.Data[offset : offset+n]
+}
+
+// LoadChunk applies one (iterator, data) pair from BF.SCANDUMP, in the
+// order they were returned, as BF.LOADCHUNK does.
+func (c *Chain) LoadChunk(iter int64, data []byte) error {
+	if iter == 1 {
+		return c.loadHeader(data)
+	}
+	if c.Links == nil {
+		return fmt.Errorf("Chunk loaded before the header")
+	}
+	link, offset := c.linkPos(iter - int64(len(data)))
+	if link == nil || uint64(len(data)) > link.Bytes-offset {
+		return fmt.Errorf("Chunk at iterator %d is out of range", iter)
+	} else if offset > uint64(len(link.Data)) {
+		return fmt.Errorf("Chunk at iterator %d skips data", iter)
+	}
+
+	// Link data grows as the chunks arrive, so the sizes in the header
+	// never decide how much is allocated
+	end := offset + uint64(len(data))
+	if end > uint64(len(link.Data)) {
+		link.Data = append(link.Data, make([]byte, end-uint64(len(link.Data)))...)
+	}
+	copy(link.Data[offset:], data)
+	return nil
+}
+
+// linkPos maps a 1-based chunk iterator to a link and byte offset.
+func (c *Chain) linkPos(iter int64) (*Link, uint64) {
+	if iter < 1 {
+		return nil, 0
+	}
+	pos := uint64(iter - 1)
+	for i := range c.Links {
+		if pos < c.Links[i].Bytes {
+			return &c.Links[i], pos
+		}
+		pos -= c.Links[i].Bytes
+	}
+	return nil, 0
+}
+
+func (c *Chain) header() []byte {
+	b := make([]byte, 0, headerSize+linkSize*len(c.Links))
+	b = binary.LittleEndian.AppendUint64(b, c.Size)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(c.Links)))
+	b = binary.LittleEndian.AppendUint32(b, c.Options)
+	b = binary.LittleEndian.AppendUint32(b, c.Growth)
+	for _, l := range c.Links {
+		b = binary.LittleEndian.AppendUint64(b, l.Bytes)
+		b = binary.LittleEndian.AppendUint64(b, l.Bits)
+		b = binary.LittleEndian.AppendUint64(b, l.Size)
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(l.Error))
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(l.BPE))
+		b = binary.LittleEndian.AppendUint32(b, l.Hashes)
+		b = binary.LittleEndian.AppendUint64(b, l.Entries)
+		b = append(b, l.N2)
+	}
+	return b
+}
+
+func (c *Chain) loadHeader(b []byte) error {
+	if len(b) < headerSize {
+		return fmt.Errorf("RedisBloom header is too short (%d)", len(b))
+	}
+	nfilters := binary.LittleEndian.Uint32(b[8:])
+	if uint64(len(b)) != headerSize+linkSize*uint64(nfilters) {
+		return fmt.Errorf("RedisBloom header length (%d) does not match %d links", len(b), nfilters)
+	}
+	hdr := Chain{
+		Size:    binary.LittleEndian.Uint64(b),
+		Options: binary.LittleEndian.Uint32(b[12:]),
+		Growth:  binary.LittleEndian.Uint32(b[16:]),
+		Links:   make([]Link, nfilters),
+	}
+	if hdr.Options&OptForce64 == 0 {
+		return fmt.Errorf("RedisBloom filters without 64-bit hashing are not supported")
+	}
+	b = b[headerSize:]
+	for i := range hdr.Links {
+		l := &hdr.Links[i]
+		l.Bytes = binary.LittleEndian.Uint64(b)
+		l.Bits = binary.LittleEndian.Uint64(b[8:])
+		l.Size = binary.LittleEndian.Uint64(b[16:])
+		l.Error = math.Float64frombits(binary.LittleEndian.Uint64(b[24:]))
+		l.BPE = math.Float64frombits(binary.LittleEndian.Uint64(b[32:]))
+		l.Hashes = binary.LittleEndian.Uint32(b[40:])
+		l.Entries = binary.LittleEndian.Uint64(b[44:])
+		l.N2 = b[52]
+		b = b[linkSize:]
+		if l.Bytes > math.MaxInt64/8 || l.Bits == 0 || l.Bits > l.Bytes*8 || l.N2 >= 64 || (l.N2 > 0 && l.Bits != 1<<l.N2) {
+			return fmt.Errorf("RedisBloom link %d has an invalid size", i)
+		}
+	}
+	*c = hdr
+	return nil
+}
+
+// Exists reports if the item may be in any link of the chain, as BF.EXISTS.
+func (c *Chain) Exists(item []byte) bool {
+	a, b := hash(item)
+	for i := len(c.Links) - 1; i >= 0; i-- {
+		if c.Links[i].check(a, b, false) {
+			return true
+		}
+	}
+	return false
+}
+
+// Add puts the item in the newest link of the chain and reports if it was
+// not already present, as BF.ADD.  Unlike RedisBloom, Add never grows the
+// chain with a new link when the newest one is at capacity, and does nothing
+// until every chunk of a loaded chain has arrived.
+func (c *Chain) Add(item []byte) bool {
+	if len(c.Links) == 0 || !c.loaded() {
+		return false
+	}
+	a, b := hash(item)
+	for i := len(c.Links) - 1; i >= 0; i-- {
+		if c.Links[i].check(a, b, false) {
+			return false
+		}
+	}
+	last := &c.Links[len(c.Links)-1]
+	last.check(a, b, true)
+	last.Size++
+	c.Size++
+	return true
+}
+
+// loaded reports if every link holds all of its data.
+func (c *Chain) loaded() bool {
+	for _, l := range c.Links {
+		if uint64(len(l.Data)) != l.Bytes {
+			return false
+		}
+	}
+	return true
+}
+
+// check tests, or with set sets, the bits for the hash pair in this link.
+// Bytes not loaded yet test as zero.
+func (l *Link) check(a, b uint64, set bool) bool {
+	found := true
+	for i := uint64(0); i < uint64(l.Hashes); i++ {
+		x := a + i*b
+		if l.N2 > 0 {
+			x &= 1<<l.N2 - 1
+		} else {
+			x %= l.Bits
+		}
+		mask := byte(1) << (x % 8)
+		if x>>3 >= uint64(len(l.Data)) {
+			return false
+		}
+		if l.Data[x>>3]&mask == 0 {
+			if !set {
+				return false
+			}
+			found = false
+			l.Data[x>>3] |= mask
+		}
+	}
+	return found
+}
+
+// hash is RedisBloom's bloom_calc_hash64.
+func hash(item []byte) (a, b uint64) {
+	a = murmurHash64A(item, 0xc6a4a7935bd1e995)
+	b = murmurHash64A(item, a)
+	return
+}
+
+func murmurHash64A(key []byte, seed uint64) uint64 {
+	const m = 0xc6a4a7935bd1e995
+	const r = 47
+	h := seed ^ (uint64(len(key)) * m)
+	for ; len(key) >= 8; key = key[8:] {
+		k := binary.LittleEndian.Uint64(key)
+		k *= m
+		k ^= k >> r
+		k *= m
+		h ^= k
+		h *= m
+	}
+	if len(key) > 0 {
+		for i := len(key) - 1; i >= 0; i-- {
+			h ^= uint64(key[i]) << (8 * i)
+		}
+		h *= m
+	}
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+	return h
+}
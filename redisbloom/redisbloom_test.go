@@ -0,0 +1,194 @@
+package redisbloom_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/pschou/go-bloom/redisbloom"
+)
+
+type chunk struct {
+	iter int64
+	data []byte
+}
+
+// readDump reads a fixture of "iterator hexdata" lines, one per
+// BF.SCANDUMP reply.
+func readDump(t *testing.T, name string) []chunk {
+	fh, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+	var out []chunk
+	scan := bufio.NewScanner(fh)
+	scan.Buffer(nil, 1<<20)
+	for scan.Scan() {
+		iter, data, _ := strings.Cut(scan.Text(), " ")
+		n, err := strconv.ParseInt(iter, 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := hex.DecodeString(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, chunk{n, b})
+	}
+	return out
+}
+
+// The fixtures are synthetic.  They were written by a script following the
+// RedisBloom sources (sb.c, bloom.c and rebloom.c), not captured from a
+// running RedisBloom, so they only pin the layout as read from those
+// sources; TestMurmurHash64A checks the hash against an independent value.
+func TestSyntheticFixtures(t *testing.T) {
+	for _, name := range []string{"scaling", "single"} {
+		chunks := readDump(t, "testdata/"+name+".dump")
+		var c redisbloom.Chain
+		for _, ch := range chunks {
+			if err := c.LoadChunk(ch.iter, ch.data); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+		}
+
+		fh, err := os.Open("testdata/" + name + ".exists")
+		if err != nil {
+			t.Fatal(err)
+		}
+		scan := bufio.NewScanner(fh)
+		for scan.Scan() {
+			line := scan.Text()
+			i := strings.LastIndexByte(line, ' ')
+			key, want := line[:i], line[i+1:] == "1"
+			if got := c.Exists([]byte(key)); got != want {
+				t.Errorf("%s: Exists(%q) = %v, want %v", name, key, got, want)
+			}
+		}
+		fh.Close()
+
+		// Dumping again with the same chunk size gives the same replies
+		chunkSize := len(chunks[1].data)
+		var iter int64
+		for i := 0; ; i++ {
+			next, data := c.ScanDump(iter, chunkSize)
+			if next == 0 {
+				if i != len(chunks) {
+					t.Errorf("%s: dumped %d chunks, want %d", name, i, len(chunks))
+				}
+				break
+			}
+			if i >= len(chunks) || next != chunks[i].iter || !bytes.Equal(data, chunks[i].data) {
+				t.Fatalf("%s: chunk %d does not match the fixture", name, i)
+			}
+			iter = next
+		}
+	}
+}
+
+// SMHasher's verification test: hash the prefixes of 0, 1, ..., 255 of
+// length i with seed 256-i, then hash the concatenated results with seed 0.
+// SMHasher lists 0x1F0D3804 for MurmurHash64A, which RedisBloom vendors.
+func TestMurmurHash64A(t *testing.T) {
+	key := make([]byte, 256)
+	hashes := make([]byte, 0, 8*256)
+	for i := 0; i < 256; i++ {
+		key[i] = byte(i)
+		hashes = binary.LittleEndian.AppendUint64(hashes, redisbloom.MurmurHash64A(key[:i], uint64(256-i)))
+	}
+	if got := uint32(redisbloom.MurmurHash64A(hashes, 0)); got != 0x1f0d3804 {
+		t.Errorf("verification value %#x, want 0x1f0d3804", got)
+	}
+}
+
+func TestAddAndReload(t *testing.T) {
+	src := redisbloom.Chain{
+		Options: redisbloom.OptForce64 | redisbloom.OptNoScaling,
+		Growth:  2,
+		Links: []redisbloom.Link{{
+			Bytes: 128, Bits: 1024, N2: 10, Hashes: 7, Entries: 100,
+			Error: 0.01, BPE: 9.585, Data: make([]byte, 128),
+		}},
+	}
+	for i := 0; i < 100; i++ {
+		if !src.Add([]byte(fmt.Sprint("key", i))) && i == 0 {
+			t.Error("first add reported the item as present")
+		}
+	}
+	if src.Add([]byte("key0")) {
+		t.Error("re-adding an item reported it as new")
+	}
+
+	var dst redisbloom.Chain
+	for iter := int64(0); ; {
+		next, data := src.ScanDump(iter, 50)
+		if next == 0 {
+			break
+		}
+		if err := dst.LoadChunk(next, data); err != nil {
+			t.Fatal(err)
+		}
+		iter = next
+	}
+	if dst.Size != src.Size || dst.Links[0].Size != src.Links[0].Size {
+		t.Errorf("size %d, want %d", dst.Size, src.Size)
+	}
+	for i := 0; i < 100; i++ {
+		if !dst.Exists([]byte(fmt.Sprint("key", i))) {
+			t.Fatalf("missing key%d", i)
+		}
+	}
+
+	if err := (&redisbloom.Chain{}).LoadChunk(10, []byte{1}); err == nil {
+		t.Error("expected an error for a chunk before the header")
+	}
+	if err := dst.LoadChunk(1000, []byte{1}); err == nil {
+		t.Error("expected an error for a chunk out of range")
+	}
+}
+
+func TestLoadHugeHeader(t *testing.T) {
+	// A header claiming a link of 2^40 bytes costs nothing until its data
+	// arrives
+	huge := redisbloom.Chain{
+		Options: redisbloom.OptForce64,
+		Links:   []redisbloom.Link{{Bytes: 1 << 40, Bits: 1 << 43, Hashes: 7}},
+	}
+	_, hdr := huge.ScanDump(0, 1<<20)
+
+	var c redisbloom.Chain
+	if err := c.LoadChunk(1, hdr); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Links[0].Data) != 0 {
+		t.Errorf("allocated %d bytes from the header", len(c.Links[0].Data))
+	}
+	if c.Exists([]byte("a")) || c.Add([]byte("a")) {
+		t.Error("partially loaded chain reported an item")
+	}
+	if err := c.LoadChunk(1+3, []byte{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.LoadChunk(100+3, []byte{1, 2, 3}); err == nil {
+		t.Error("expected an error for a chunk that skips data")
+	}
+	if next, data := c.ScanDump(1, 1<<20); next != 4 || len(data) != 3 {
+		t.Errorf("dump of a partial link returned %d bytes up to %d", len(data), next)
+	}
+	if next, _ := c.ScanDump(4, 1<<20); next != 0 {
+		t.Errorf("dump past the loaded data continued at %d", next)
+	}
+
+	huge.Links[0].Bytes = 1 << 62
+	_, hdr = huge.ScanDump(0, 1<<20)
+	if err := c.LoadChunk(1, hdr); err == nil {
+		t.Error("expected an error for a link size that overflows")
+	}
+}
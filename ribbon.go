@@ -0,0 +1,156 @@
+// Copyright 2020 github.com/pschou/go-bloom-worm
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bwdb
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+
+	zxxh3 "github.com/zeebo/xxh3"
+)
+
+// ribbonWidth is the number of columns a key touches, one uint64.
+const ribbonWidth = 64
+
+// A RibbonFilter is a static filter for a fixed set of keys, the standard
+// ribbon of RocksDB.  Every key maps to a 64 bit coefficient row starting at
+// a slot and an r bit fingerprint; the filter stores a solution to the
+// system where each row XORs to its key's fingerprint.  It uses about
+// r * 1.07 bits per key for a false positive rate of 2^-r.
+//
+// The solution is kept column-major: Data holds Bits planes of Slots bits
+// rounded up to whole words plus one for padding, so a lookup reads one 64
+// bit window per plane.
+type RibbonFilter struct {
+	Seed  uint64
+	Bits  uint
+	Slots int
+	Data  []uint64
+}
+
+// NewRibbonFilter builds a filter holding keys with bits of fingerprint per
+// key, 1 to 16.  Construction fails with a small chance for a given seed, in
+// which case it is retried with the next seed and, after a few failures,
+// more slots.
+func NewRibbonFilter(keys [][]byte, bits uint) (*RibbonFilter, error) {
+	if bits < 1 || bits > 16 {
+		return nil, fmt.Errorf("Ribbon bits (%d) has to be between 1 and 16", bits)
+	}
+	n := len(keys)
+	slots := n + n/16 + ribbonWidth
+	for seed := uint64(0); seed < 64; seed++ {
+		if seed > 0 && seed%4 == 0 {
+			slots += slots / 32
+		}
+		f := &RibbonFilter{Seed: seed, Bits: bits, Slots: slots}
+		if f.build(keys) {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("Ribbon construction failed for %d keys", n)
+}
+
+// Test if the string may be in the filter
+func (f *RibbonFilter) TestString(s string) bool {
+	return f.test(s2b(s))
+}
+
+// Test if a byte slice may be in the filter
+func (f *RibbonFilter) Test(d []byte) bool {
+	return f.test(d)
+}
+
+// FalsePositiveRate returns the chance a key not in the filter tests
+// positive, 2^-Bits regardless of the number of keys.
+func (f *RibbonFilter) FalsePositiveRate(n int) float64 {
+	return math.Ldexp(1, -int(f.Bits))
+}
+
+// row returns the first slot, coefficients and fingerprint of a key.  The
+// lowest coefficient bit is always set so every row has a pivot.  The start
+// comes from Hi and the coefficients from Lo, so the fingerprint is a remix
+// of both to keep it independent of either.
+func (f *RibbonFilter) row(d []byte) (start int, coeff uint64, result uint16) {
+	h := zxxh3.Hash128Seed(d, f.Seed)
+	hi, _ := bits.Mul64(h.Hi, uint64(f.Slots-ribbonWidth+1))
+	fp := (h.Hi ^ h.Lo) * 0x9e3779b97f4a7c15 >> 48
+	return int(hi), h.Lo | 1, uint16(fp) & (1<<f.Bits - 1)
+}
+
+// window returns the 64 bits of a plane starting at slot i.
+func (f *RibbonFilter) window(plane []uint64, i int) uint64 {
+	w, off := i/64, uint(i%64)
+	if off == 0 {
+		return plane[w]
+	}
+	return plane[w]>>off | plane[w+1]<<(64-off)
+}
+
+func (f *RibbonFilter) test(d []byte) bool {
+	start, coeff, result := f.row(d)
+	words := len(f.Data) / int(f.Bits)
+	for b := 0; b < int(f.Bits); b++ {
+		plane := f.Data[b*words : (b+1)*words]
+		if uint16(bits.OnesCount64(coeff&f.window(plane, start))&1) != result>>b&1 {
+			return false
+		}
+	}
+	return true
+}
+
+// build runs banded Gaussian elimination on the key rows and then back
+// substitution, reporting false if the rows are not independent.
+func (f *RibbonFilter) build(keys [][]byte) bool {
+	coeffs := make([]uint64, f.Slots)
+	results := make([]uint16, f.Slots)
+	for _, k := range keys {
+		i, c, r := f.row(k)
+		for {
+			if coeffs[i] == 0 {
+				coeffs[i], results[i] = c, r
+				break
+			}
+			c ^= coeffs[i]
+			r ^= results[i]
+			if c == 0 {
+				if r != 0 {
+					return false
+				}
+				break // a duplicate key
+			}
+			tz := bits.TrailingZeros64(c)
+			i += tz
+			c >>= uint(tz)
+		}
+	}
+
+	words := f.Slots/64 + 2
+	f.Data = make([]uint64, words*int(f.Bits))
+	for i := f.Slots - 1; i >= 0; i-- {
+		c := coeffs[i]
+		if c == 0 {
+			// A free variable, which is set at random so probes that
+			// touch it still match with chance 2^-Bits
+			c, results[i] = 1, uint16((uint64(i)+f.Seed)*0x9e3779b97f4a7c15>>48)
+		}
+		for b := 0; b < int(f.Bits); b++ {
+			plane := f.Data[b*words : (b+1)*words]
+			v := uint64(results[i]>>b&1) ^ uint64(bits.OnesCount64(c&f.window(plane, i))&1)
+			plane[i/64] |= v << uint(i%64)
+		}
+	}
+	return true
+}
@@ -0,0 +1,57 @@
+package bwdb_test
+
+import (
+	"fmt"
+	"testing"
+
+	bloom "github.com/pschou/go-bloom"
+	"github.com/pschou/go-bloom/bloomtest"
+)
+
+func ExampleRibbonFilter() {
+	keys := [][]byte{[]byte("hello"), []byte("world")}
+	filter, _ := bloom.NewRibbonFilter(keys, 8)
+	fmt.Println("hello", filter.TestString("hello"))
+	fmt.Println("world", filter.Test([]byte("world")))
+	// Output:
+	// hello true
+	// world true
+}
+
+func TestRibbonFilter(t *testing.T) {
+	for _, n := range []int{0, 1, 100, 20000} {
+		for _, bits := range []uint{1, 7, 16} {
+			ins, probes := bloomtest.DisjointKeys(int64(n), n, 1<<17, 12)
+			keys := ins
+			if n <= 100 {
+				keys = append(keys, ins[:n/2]...) // with duplicates
+			}
+			filter, err := bloom.NewRibbonFilter(keys, bits)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := bloomtest.MeasureFPR(filter, ins, probes)
+			if !r.Consistent() {
+				t.Errorf("%d keys, %d bits: %v", n, bits, r)
+			}
+			if n == 20000 {
+				if per := float64(len(filter.Data)*64) / float64(n); per > float64(bits)*1.12 {
+					t.Errorf("%d bits uses %.2f bits per key", bits, per)
+				}
+			}
+		}
+	}
+	if _, err := bloom.NewRibbonFilter(nil, 0); err == nil {
+		t.Error("expected an error for zero bits")
+	}
+}
+
+func BenchmarkRibbonTest(b *testing.B) {
+	dat := []byte("helloworld")
+	ins, _ := bloomtest.DisjointKeys(1, 1<<16, 0, 12)
+	filter, _ := bloom.NewRibbonFilter(ins, 8)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		filter.Test(dat)
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2020 github.com/pschou/go-bloom-worm
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bwdb
+
+import (
+	"fmt"
+	"math/bits"
+	"sync"
+
+	zxxh3 "github.com/zeebo/xxh3"
+)
+
+// A ShardedFilter spreads keys over independent Filter shards, each guarded
+// by its own lock, so concurrent writers on many cores rarely touch the same
+// cache lines.  Keys are routed by the top bits of their hash.
+type ShardedFilter struct {
+	shards []shard
+	shift  uint
+}
+
+type shard struct {
+	mu sync.RWMutex
+	f  Filter
+	_  [16]byte // pad to a cache line
+}
+
+// NewShardedFilter creates a filter with n shards of size bytes each.  The
+// number of shards must be a power of two.
+func NewShardedFilter(n, size int) (*ShardedFilter, error) {
+	if n < 1 || n&(n-1) != 0 {
+		return nil, fmt.Errorf("Shard count (%d) has to be a power of two", n)
+	} else if size < 1 {
+		return nil, fmt.Errorf("Shard size (%d) has to be a positive value", size)
+	}
+	s := &ShardedFilter{
+		shards: make([]shard, n),
+		shift:  uint(64 - bits.TrailingZeros(uint(n))),
+	}
+	for i := range s.shards {
+		s.shards[i].f.Data = make([]byte, size)
+	}
+	return s, nil
+}
+
+func (s *ShardedFilter) shard(hash uint64) *shard {
+	if s.shift == 64 {
+		return &s.shards[0]
+	}
+	return &s.shards[hash>>s.shift]
+}
+
+func (s *ShardedFilter) test(hash uint64) bool {
+	sh := s.shard(hash)
+	sh.mu.RLock()
+	hit := sh.f.test(hash)
+	sh.mu.RUnlock()
+	return hit
+}
+
+func (s *ShardedFilter) add(hash uint64) {
+	sh := s.shard(hash)
+	sh.mu.Lock()
+	sh.f.add(hash)
+	sh.mu.Unlock()
+}
+
+// Test if the string may be in the filter
+func (s *ShardedFilter) TestString(str string) bool {
+	return s.test(zxxh3.Hash(s2b(str)))
+}
+
+// Test if a byte slice may be in the filter
+func (s *ShardedFilter) Test(d []byte) bool {
+	return s.test(zxxh3.Hash(d))
+}
+
+// Add a string to the filter
+func (s *ShardedFilter) AddString(str string) (hash uint64) {
+	hash = zxxh3.Hash(s2b(str))
+	s.add(hash)
+	return
+}
+
+// Add a byte slice to the filter
+func (s *ShardedFilter) Add(d []byte) (hash uint64) {
+	hash = zxxh3.Hash(d)
+	s.add(hash)
+	return
+}
+
+// Load replaces the contents of every shard with a copy of f, such as one
+// produced by Merge.  Every key in f then tests positive, whichever shard it
+// routes to.  The size of f has to match the shard size.
+func (s *ShardedFilter) Load(f *Filter) error {
+	if len(f.Data) != len(s.shards[0].f.Data) {
+		return fmt.Errorf("Filter size (%d) does not match shard size (%d)", len(f.Data), len(s.shards[0].f.Data))
+	}
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		copy(sh.f.Data, f.Data)
+		sh.mu.Unlock()
+	}
+	return nil
+}
+
+// Size returns the size in bytes of each shard.
+func (s *ShardedFilter) Size() int {
+	return len(s.shards[0].f.Data)
+}
+
+// Merge collapses the shards into a single Filter the size of one shard.
+// Every shard places a key at the same bit a plain Filter of that size
+// would, so the merged filter matches every key added to any shard.
+func (s *ShardedFilter) Merge() *Filter {
+	dat := make([]byte, len(s.shards[0].f.Data))
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.RLock()
+		for j, v := range sh.f.Data {
+			dat[j] |= v
+		}
+		sh.mu.RUnlock()
+	}
+	return &Filter{Data: dat}
+}
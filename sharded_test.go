@@ -0,0 +1,94 @@
+package bwdb_test
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+
+	bloom "github.com/pschou/go-bloom"
+)
+
+func ExampleShardedFilter() {
+	filter, _ := bloom.NewShardedFilter(8, 100)
+	filter.AddString("hello")
+	fmt.Println("test", filter.TestString("hello"))
+
+	// Collapse the shards for export
+	merged := filter.Merge()
+	fmt.Println("merged size:", len(merged.Data))
+	fmt.Println("merged test", merged.TestString("hello"))
+	// Output:
+	// test true
+	// merged size: 100
+	// merged test true
+}
+
+func TestShardedFilterConcurrent(t *testing.T) {
+	filter, err := bloom.NewShardedFilter(16, 1<<12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				filter.AddString(strconv.Itoa(w*1000 + i))
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	merged := filter.Merge()
+	for i := 0; i < 8000; i++ {
+		key := strconv.Itoa(i)
+		if !filter.TestString(key) || !merged.TestString(key) {
+			t.Fatalf("missing key %q", key)
+		}
+	}
+}
+
+func TestNewShardedFilterErrors(t *testing.T) {
+	if _, err := bloom.NewShardedFilter(3, 100); err == nil {
+		t.Error("expected an error for a non power of two shard count")
+	}
+	if _, err := bloom.NewShardedFilter(4, 0); err == nil {
+		t.Error("expected an error for an empty shard")
+	}
+}
+
+func BenchmarkShardedAddParallel(b *testing.B) {
+	filter, _ := bloom.NewShardedFilter(64, 1<<18)
+	b.RunParallel(func(pb *testing.PB) {
+		dat := []byte("helloworld")
+		for pb.Next() {
+			dat[0]++
+			filter.Add(dat)
+		}
+	})
+}
+
+func TestShardedFilterLoad(t *testing.T) {
+	src, _ := bloom.NewShardedFilter(4, 256)
+	for i := 0; i < 100; i++ {
+		src.AddString(strconv.Itoa(i))
+	}
+
+	dst, _ := bloom.NewShardedFilter(8, 256)
+	if dst.Size() != 256 {
+		t.Errorf("shard size %d", dst.Size())
+	}
+	if err := dst.Load(src.Merge()); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if !dst.TestString(strconv.Itoa(i)) {
+			t.Fatalf("missing key %d after load", i)
+		}
+	}
+	if err := dst.Load(&bloom.Filter{make([]byte, 10)}); err == nil {
+		t.Error("expected an error loading a filter of the wrong size")
+	}
+}
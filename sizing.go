@@ -0,0 +1,52 @@
+// Copyright 2020 github.com/pschou/go-bloom-worm
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bwdb
+
+import (
+	"math"
+)
+
+// SizeFor returns the number of bytes a Filter needs to hold n keys with a
+// false positive rate of at most fpr.  A Filter sets one bit per key, so the
+// rate after n keys in m bits is 1 - exp(-n/m).  A size too large for an
+// int is returned as math.MaxInt, which no allocation can satisfy.
+func SizeFor(n int, fpr float64) int {
+	if n < 1 || fpr <= 0 || fpr >= 1 {
+		return 1
+	}
+	m := math.Ceil(-float64(n) / math.Log1p(-fpr) / 8)
+	if m >= math.MaxInt {
+		return math.MaxInt
+	}
+	return int(m)
+}
+
+// FalsePositiveRate returns the expected false positive rate of a Filter of
+// size bytes after n distinct keys have been added.
+func FalsePositiveRate(n, size int) float64 {
+	if size < 1 {
+		return 1
+	}
+	return -math.Expm1(-float64(n) / float64(size*8))
+}
+
+// FillRatio returns the fraction of bits set in the filter, which is also
+// the chance that a key not in the filter tests positive.
+func (f *Filter) FillRatio() float64 {
+	if len(f.Data) == 0 {
+		return 0
+	}
+	return float64(popcount(f.Data)) / float64(len(f.Data)*8)
+}
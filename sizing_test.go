@@ -0,0 +1,55 @@
+package bwdb_test
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"testing"
+
+	bloom "github.com/pschou/go-bloom"
+)
+
+func ExampleSizeFor() {
+	size := bloom.SizeFor(1000, 0.01)
+	fmt.Println("size:", size)
+	fmt.Printf("fpr: %.4f\n", bloom.FalsePositiveRate(1000, size))
+	// Output:
+	// size: 12438
+	// fpr: 0.0100
+}
+
+func TestFillRatio(t *testing.T) {
+	filter := bloom.Filter{make([]byte, bloom.SizeFor(5000, 0.05))}
+	for i := 0; i < 5000; i++ {
+		filter.AddString(strconv.Itoa(i))
+	}
+	got, want := filter.FillRatio(), bloom.FalsePositiveRate(5000, len(filter.Data))
+	if math.Abs(got-want) > 0.005 {
+		t.Errorf("fill ratio %.4f, expected near %.4f", got, want)
+	}
+}
+
+func TestSizeFor(t *testing.T) {
+	for _, c := range []struct {
+		n    int
+		fpr  float64
+		want int
+	}{
+		{1000, 0.01, 12438},
+		{0, 0.01, 1},
+		{1000, 0, 1},
+		{1000, 1, 1},
+		{math.MaxInt, 1e-9, math.MaxInt},
+		{1000, 1e-300, math.MaxInt},
+	} {
+		if got := bloom.SizeFor(c.n, c.fpr); got != c.want {
+			t.Errorf("SizeFor(%d, %v) = %d, want %d", c.n, c.fpr, got, c.want)
+		}
+	}
+	if got := bloom.FalsePositiveRate(10, 0); got != 1 {
+		t.Errorf("empty filter fpr %v", got)
+	}
+	if got := (&bloom.Filter{}).FillRatio(); got != 0 {
+		t.Errorf("empty filter fill ratio %v", got)
+	}
+}
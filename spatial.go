@@ -0,0 +1,126 @@
+// Copyright 2020 github.com/pschou/go-bloom-worm
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bwdb
+
+import (
+	"fmt"
+	"math"
+)
+
+// A SpatialFilter is a spatial bloom filter: one structure for keys in up to
+// 255 disjoint areas, numbered from 1, where higher areas take priority.
+// Every key sets its K cells to at least its area, and a query returns the
+// lowest of its K cells.  A member is reported in its own area unless all of
+// its cells were taken over by higher areas, and a non-member is reported in
+// no area (0) unless all of its cells are set.
+type SpatialFilter struct {
+	K       int
+	Cells   []uint8
+	Members []int // keys added per area, index 0 unused
+}
+
+// NewSpatialFilter creates a filter with k cells per key out of cells, for
+// areas 1 to areas.
+func NewSpatialFilter(k, cells, areas int) (*SpatialFilter, error) {
+	if k < 1 {
+		return nil, fmt.Errorf("Hash count (%d) has to be a positive value", k)
+	} else if cells < 1 {
+		return nil, fmt.Errorf("Cell count (%d) has to be a positive value", cells)
+	} else if areas < 1 || areas > 255 {
+		return nil, fmt.Errorf("Area count (%d) has to be between 1 and 255", areas)
+	}
+	return &SpatialFilter{K: k, Cells: make([]uint8, cells), Members: make([]int, areas+1)}, nil
+}
+
+// Add a byte slice to an area
+func (f *SpatialFilter) Add(d []byte, area uint8) error {
+	if area == 0 || int(area) >= len(f.Members) {
+		return fmt.Errorf("Area (%d) has to be between 1 and %d", area, len(f.Members)-1)
+	}
+	h1, h2 := hashPair(d)
+	for i := 0; i < f.K; i++ {
+		c := &f.Cells[(h1+uint64(i)*h2)%uint64(len(f.Cells))]
+		if *c < area {
+			*c = area
+		}
+	}
+	f.Members[area]++
+	return nil
+}
+
+// Add a string to an area
+func (f *SpatialFilter) AddString(s string, area uint8) error {
+	return f.Add(s2b(s), area)
+}
+
+// Test returns the area a byte slice may be in, or 0 for none
+func (f *SpatialFilter) Test(d []byte) uint8 {
+	h1, h2 := hashPair(d)
+	area := uint8(255)
+	for i := 0; i < f.K; i++ {
+		if c := f.Cells[(h1+uint64(i)*h2)%uint64(len(f.Cells))]; c < area {
+			if c == 0 {
+				return 0
+			}
+			area = c
+		}
+	}
+	return area
+}
+
+// Test returns the area a string may be in, or 0 for none
+func (f *SpatialFilter) TestString(s string) uint8 {
+	return f.Test(s2b(s))
+}
+
+// Emersion returns the fraction of the cells set by an area that still hold
+// it, the observed count over the expected count of distinct cells its keys
+// set.  Higher areas overwrite lower ones, so this falls below 1 as they
+// fill up, and a low emersion means members of the area are likely to be
+// reported in a higher one.  It is NaN for an area without keys.  Keys
+// added twice are counted twice.
+func (f *SpatialFilter) Emersion(area uint8) float64 {
+	if int(area) >= len(f.Members) || area == 0 || f.Members[area] == 0 {
+		return math.NaN()
+	}
+	m := float64(len(f.Cells))
+	set := m * -math.Expm1(float64(f.K*f.Members[area])*math.Log1p(-1/m))
+	return float64(f.count(area, area)) / set
+}
+
+// FalsePositiveRate returns the chance a key that was never added is reported
+// in the area, from the cells currently set: all K cells have to hold the
+// area or higher, and not all of them higher.
+func (f *SpatialFilter) FalsePositiveRate(area uint8) float64 {
+	if area == 0 {
+		return 0
+	}
+	m := float64(len(f.Cells))
+	atLeast, above := float64(f.count(area, 255))/m, 0.0
+	if area < 255 {
+		above = float64(f.count(area+1, 255)) / m
+	}
+	return math.Pow(atLeast, float64(f.K)) - math.Pow(above, float64(f.K))
+}
+
+// count returns the number of cells holding an area from lo to hi.
+func (f *SpatialFilter) count(lo, hi uint8) (n int) {
+	for _, c := range f.Cells {
+		if c >= lo && c <= hi {
+			n++
+		}
+	}
+	return
+}
@@ -0,0 +1,77 @@
+package bwdb_test
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"testing"
+
+	bloom "github.com/pschou/go-bloom"
+)
+
+func ExampleSpatialFilter() {
+	filter, _ := bloom.NewSpatialFilter(4, 1<<12, 3)
+	filter.AddString("spam.example", 1)
+	filter.AddString("malware.example", 3)
+
+	fmt.Println("spam.example", filter.TestString("spam.example"))
+	fmt.Println("malware.example", filter.TestString("malware.example"))
+	fmt.Println("good.example", filter.TestString("good.example"))
+	// Output:
+	// spam.example 1
+	// malware.example 3
+	// good.example 0
+}
+
+func TestSpatialFilter(t *testing.T) {
+	const n = 2000
+	filter, _ := bloom.NewSpatialFilter(4, 1<<15, 3)
+	for area := uint8(1); area <= 3; area++ {
+		for i := 0; i < n; i++ {
+			filter.AddString(strconv.Itoa(int(area))+"-"+strconv.Itoa(i), area)
+		}
+	}
+
+	for area := uint8(1); area <= 3; area++ {
+		var own int
+		for i := 0; i < n; i++ {
+			got := filter.TestString(strconv.Itoa(int(area)) + "-" + strconv.Itoa(i))
+			if got < area {
+				t.Fatalf("key of area %d reported in %d", area, got)
+			}
+			if got == area {
+				own++
+			}
+		}
+		e := filter.Emersion(area)
+		if area == 3 && math.Abs(e-1) > 0.02 {
+			t.Errorf("top area emersion %v", e)
+		}
+		// A member keeps its area unless all of its cells were taken over
+		if want := 1 - math.Pow(1-e, 4); math.Abs(float64(own)/n-want) > 0.01 {
+			t.Errorf("area %d: %d of %d reported in their own area, emersion %.4f", area, own, n, e)
+		}
+	}
+
+	var got [4]int
+	const probes = 100000
+	for i := 0; i < probes; i++ {
+		got[filter.TestString("absent-"+strconv.Itoa(i))]++
+	}
+	for area := uint8(1); area <= 3; area++ {
+		want := filter.FalsePositiveRate(area)
+		if obs := float64(got[area]) / probes; math.Abs(obs-want) > 4*math.Sqrt(want/probes)+1e-4 {
+			t.Errorf("area %d: fpr %.5f, want %.5f", area, obs, want)
+		}
+	}
+
+	if err := filter.AddString("x", 4); err == nil {
+		t.Error("expected an error for an area past the configured count")
+	}
+	if !math.IsNaN(filter.Emersion(0)) {
+		t.Error("expected NaN emersion for area 0")
+	}
+	if _, err := bloom.NewSpatialFilter(1, 10, 256); err == nil {
+		t.Error("expected an error for 256 areas")
+	}
+}
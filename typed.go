@@ -0,0 +1,125 @@
+// Copyright 2020 github.com/pschou/go-bloom-worm
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bwdb
+
+import (
+	"encoding/binary"
+	"math"
+	"net/netip"
+
+	zxxh3 "github.com/zeebo/xxh3"
+)
+
+// The typed helpers below hash a canonical byte encoding of the value with
+// xxh3, so AddUint64(v) sets the same bit as Add on the encoded bytes:
+//
+//	uint64   8 bytes, big-endian
+//	int64    8 bytes, big-endian two's complement
+//	float64  8 bytes, big-endian IEEE 754 bits, with -0 stored as +0 and
+//	         every NaN stored as 0x7ff8000000000001
+//	UUID     the 16 bytes as given
+//	netip    4 bytes for IPv4, 16 bytes for IPv6 with the zone dropped, and
+//	         no bytes for the zero Addr; IPv4-mapped IPv6 addresses are not
+//	         unmapped
+//
+// Smaller integer types should be widened to 64 bits before use.
+
+func hashUint64(v uint64) uint64 {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	return zxxh3.Hash(b[:])
+}
+
+func hashFloat64(v float64) uint64 {
+	switch {
+	case v == 0:
+		v = 0
+	case v != v:
+		v = math.NaN()
+	}
+	return hashUint64(math.Float64bits(v))
+}
+
+func hashNetIP(ip netip.Addr) uint64 {
+	switch {
+	case ip.Is4():
+		b := ip.As4()
+		return zxxh3.Hash(b[:])
+	case ip.Is6():
+		b := ip.As16()
+		return zxxh3.Hash(b[:])
+	}
+	return zxxh3.Hash(nil)
+}
+
+// Add a uint64 to the filter
+func (f *Filter) AddUint64(v uint64) (hash uint64) {
+	hash = hashUint64(v)
+	f.add(hash)
+	return
+}
+
+// Test if a uint64 may be in the filter
+func (f *Filter) TestUint64(v uint64) bool {
+	return f.test(hashUint64(v))
+}
+
+// Add an int64 to the filter
+func (f *Filter) AddInt64(v int64) (hash uint64) {
+	hash = hashUint64(uint64(v))
+	f.add(hash)
+	return
+}
+
+// Test if an int64 may be in the filter
+func (f *Filter) TestInt64(v int64) bool {
+	return f.test(hashUint64(uint64(v)))
+}
+
+// Add a float64 to the filter
+func (f *Filter) AddFloat64(v float64) (hash uint64) {
+	hash = hashFloat64(v)
+	f.add(hash)
+	return
+}
+
+// Test if a float64 may be in the filter
+func (f *Filter) TestFloat64(v float64) bool {
+	return f.test(hashFloat64(v))
+}
+
+// Add a UUID to the filter
+func (f *Filter) AddUUID(u [16]byte) (hash uint64) {
+	hash = zxxh3.Hash(u[:])
+	f.add(hash)
+	return
+}
+
+// Test if a UUID may be in the filter
+func (f *Filter) TestUUID(u [16]byte) bool {
+	return f.test(zxxh3.Hash(u[:]))
+}
+
+// Add an IP address to the filter
+func (f *Filter) AddNetIP(ip netip.Addr) (hash uint64) {
+	hash = hashNetIP(ip)
+	f.add(hash)
+	return
+}
+
+// Test if an IP address may be in the filter
+func (f *Filter) TestNetIP(ip netip.Addr) bool {
+	return f.test(hashNetIP(ip))
+}
@@ -0,0 +1,85 @@
+package bwdb_test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/netip"
+	"testing"
+
+	bloom "github.com/pschou/go-bloom"
+)
+
+func ExampleFilter_AddUint64() {
+	filter := bloom.Filter{make([]byte, 100)}
+	filter.AddUint64(42)
+
+	// The canonical encoding is 8 big-endian bytes
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], 42)
+	fmt.Println("test", filter.TestUint64(42), filter.Test(b[:]))
+	// Output:
+	// test true true
+}
+
+func TestTypedEncodings(t *testing.T) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(0xfffffffffffffffe))
+	want := (&bloom.Filter{make([]byte, 100)}).Add(b[:])
+
+	filter := bloom.Filter{make([]byte, 100)}
+	if got := filter.AddInt64(-2); got != want {
+		t.Errorf("AddInt64 hash %x, want %x", got, want)
+	}
+	if got := filter.AddUint64(0xfffffffffffffffe); got != want {
+		t.Errorf("AddUint64 hash %x, want %x", got, want)
+	}
+
+	if filter.AddFloat64(math.Copysign(0, -1)) != filter.AddFloat64(0) {
+		t.Error("negative zero does not match zero")
+	}
+	if filter.AddFloat64(math.NaN()) != filter.AddFloat64(math.Float64frombits(0x7ff0000000000abc)) {
+		t.Error("NaN payloads do not match")
+	}
+
+	u := [16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	if filter.AddUUID(u) != filter.Add(u[:]) {
+		t.Error("UUID does not hash as its bytes")
+	}
+
+	v4 := netip.MustParseAddr("192.0.2.1")
+	if filter.AddNetIP(v4) != filter.Add([]byte{192, 0, 2, 1}) {
+		t.Error("IPv4 does not hash as 4 bytes")
+	}
+	v6 := netip.MustParseAddr("2001:db8::1%eth0")
+	b16 := v6.As16()
+	if filter.AddNetIP(v6) != filter.Add(b16[:]) {
+		t.Error("IPv6 does not hash as 16 bytes")
+	}
+	if !filter.TestNetIP(v6.WithZone("")) {
+		t.Error("zone was not dropped")
+	}
+}
+
+func TestTypedAllocs(t *testing.T) {
+	filter := bloom.Filter{make([]byte, 1<<10)}
+	ip := netip.MustParseAddr("2001:db8::1")
+	allocs := testing.AllocsPerRun(100, func() {
+		filter.AddUint64(1)
+		filter.TestUint64(1)
+		filter.AddInt64(-1)
+		filter.TestFloat64(1.5)
+		filter.AddUUID([16]byte{})
+		filter.TestNetIP(ip)
+	})
+	if allocs != 0 {
+		t.Errorf("typed helpers allocated %v times", allocs)
+	}
+}
+
+func BenchmarkAddUint64(b *testing.B) {
+	filter := bloom.Filter{make([]byte, 1<<24)}
+	for n := 0; n < b.N; n++ {
+		filter.AddUint64(uint64(n))
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2020 github.com/pschou/go-bloom-worm
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bwdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"unsafe"
+
+	zxxh3 "github.com/zeebo/xxh3"
+)
+
+// An Encoder turns keys of type K into the bytes that are hashed into a
+// filter.  The ID names the encoding and is recorded when a Typed filter is
+// serialized, so a filter is never loaded with a mismatched encoder.
+type Encoder[K any] struct {
+	ID     string
+	Append func(dst []byte, key K) []byte
+}
+
+// StringEncoder encodes strings as their bytes, matching Filter.AddString.
+func StringEncoder() Encoder[string] {
+	return Encoder[string]{
+		ID: "string",
+		Append: func(dst []byte, key string) []byte {
+			return append(dst, key...)
+		},
+	}
+}
+
+// UintEncoder widens unsigned integers to 8 big-endian bytes, matching
+// Filter.AddUint64.
+func UintEncoder[K ~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr]() Encoder[K] {
+	return Encoder[K]{
+		ID: "uint64",
+		Append: func(dst []byte, key K) []byte {
+			return binary.BigEndian.AppendUint64(dst, uint64(key))
+		},
+	}
+}
+
+// IntEncoder widens signed integers to 8 big-endian bytes, matching
+// Filter.AddInt64.
+func IntEncoder[K ~int | ~int8 | ~int16 | ~int32 | ~int64]() Encoder[K] {
+	return Encoder[K]{
+		ID: "int64",
+		Append: func(dst []byte, key K) []byte {
+			return binary.BigEndian.AppendUint64(dst, uint64(int64(key)))
+		},
+	}
+}
+
+// ArrayEncoder encodes a fixed size byte array, such as a [16]byte UUID, as
+// its bytes.  It panics if K is not a [N]byte array.
+func ArrayEncoder[K any]() Encoder[K] {
+	var zero K
+	t := reflect.TypeOf(zero)
+	if t == nil || t.Kind() != reflect.Array || t.Elem().Kind() != reflect.Uint8 {
+		panic(fmt.Sprintf("ArrayEncoder needs a byte array type, not %v", t))
+	}
+	n := t.Len()
+	return Encoder[K]{
+		ID: fmt.Sprintf("[%d]byte", n),
+		Append: func(dst []byte, key K) []byte {
+			return append(dst, unsafe.Slice((*byte)(unsafe.Pointer(&key)), n)...)
+		},
+	}
+}
+
+// Typed wraps a Filter so it only accepts keys of type K.
+type Typed[K any] struct {
+	Filter  Filter
+	Encoder Encoder[K]
+}
+
+// NewTyped creates a typed filter of size bytes using the given encoder.
+func NewTyped[K any](size int, enc Encoder[K]) *Typed[K] {
+	return &Typed[K]{Filter: Filter{make([]byte, size)}, Encoder: enc}
+}
+
+func (t *Typed[K]) hash(key K) uint64 {
+	var buf [64]byte
+	return zxxh3.Hash(t.Encoder.Append(buf[:0], key))
+}
+
+// Add a key to the filter
+func (t *Typed[K]) Add(key K) (hash uint64) {
+	hash = t.hash(key)
+	t.Filter.add(hash)
+	return
+}
+
+// Test if a key may be in the filter
+func (t *Typed[K]) Test(key K) bool {
+	return t.Filter.test(t.hash(key))
+}
+
+// MarshalBinary writes the uvarint length of the encoder ID, the ID, and the
+// filter data.
+func (t *Typed[K]) MarshalBinary() ([]byte, error) {
+	out := make([]byte, 0, binary.MaxVarintLen64+len(t.Encoder.ID)+len(t.Filter.Data))
+	out = binary.AppendUvarint(out, uint64(len(t.Encoder.ID)))
+	out = append(out, t.Encoder.ID...)
+	return append(out, t.Filter.Data...), nil
+}
+
+// UnmarshalBinary loads data written by MarshalBinary.  The recorded encoder
+// ID has to match the ID of the filter's Encoder.
+func (t *Typed[K]) UnmarshalBinary(b []byte) error {
+	n, sz := binary.Uvarint(b)
+	if sz <= 0 || n > uint64(len(b)-sz) {
+		return fmt.Errorf("Typed filter has an invalid encoder ID")
+	}
+	id := string(b[sz : sz+int(n)])
+	if id != t.Encoder.ID {
+		return fmt.Errorf("Typed filter encoder %q does not match %q", id, t.Encoder.ID)
+	}
+	t.Filter.Data = append([]byte(nil), b[sz+int(n):]...)
+	return nil
+}
@@ -0,0 +1,77 @@
+package bwdb_test
+
+import (
+	"fmt"
+	"testing"
+
+	bloom "github.com/pschou/go-bloom"
+)
+
+type userID uint32
+
+func ExampleTyped() {
+	users := bloom.NewTyped(100, bloom.UintEncoder[userID]())
+	users.Add(userID(1234))
+	fmt.Println("test", users.Test(1234))
+
+	// Only a filter with the same encoder can load the data
+	buf, _ := users.MarshalBinary()
+	names := bloom.NewTyped(0, bloom.StringEncoder())
+	fmt.Println(names.UnmarshalBinary(buf))
+	// Output:
+	// test true
+	// Typed filter encoder "uint64" does not match "string"
+}
+
+func TestTypedMatchesFilter(t *testing.T) {
+	plain := bloom.Filter{make([]byte, 100)}
+
+	ints := bloom.NewTyped(100, bloom.IntEncoder[int8]())
+	if ints.Add(-3) != plain.AddInt64(-3) {
+		t.Error("IntEncoder does not match AddInt64")
+	}
+	uints := bloom.NewTyped(100, bloom.UintEncoder[uint16]())
+	if uints.Add(7) != plain.AddUint64(7) {
+		t.Error("UintEncoder does not match AddUint64")
+	}
+	strs := bloom.NewTyped(100, bloom.StringEncoder())
+	if strs.Add("hello") != plain.AddString("hello") {
+		t.Error("StringEncoder does not match AddString")
+	}
+	uuids := bloom.NewTyped(100, bloom.ArrayEncoder[[16]byte]())
+	u := [16]byte{0: 1, 15: 2}
+	if uuids.Add(u) != plain.AddUUID(u) {
+		t.Error("ArrayEncoder does not match AddUUID")
+	}
+	if uuids.Encoder.ID != "[16]byte" {
+		t.Errorf("unexpected array encoder ID %q", uuids.Encoder.ID)
+	}
+}
+
+func TestTypedRoundTrip(t *testing.T) {
+	a := bloom.NewTyped(100, bloom.ArrayEncoder[[4]byte]())
+	a.Add([4]byte{10, 0, 0, 1})
+	buf, err := a.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &bloom.Typed[[4]byte]{Encoder: bloom.ArrayEncoder[[4]byte]()}
+	if err := b.UnmarshalBinary(buf); err != nil {
+		t.Fatal(err)
+	}
+	if !b.Test([4]byte{10, 0, 0, 1}) {
+		t.Error("key lost in round trip")
+	}
+	if err := b.UnmarshalBinary([]byte{0xff}); err == nil {
+		t.Error("expected an error for a truncated encoder ID")
+	}
+}
+
+func TestArrayEncoderPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic for a non byte array")
+		}
+	}()
+	bloom.ArrayEncoder[[2]int]()
+}